@@ -4,21 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"microcoin/internal/algo"
 	"microcoin/internal/auth"
 	"microcoin/internal/database"
 	"microcoin/internal/idempotency"
+	"microcoin/internal/instruments"
 	"microcoin/internal/ledger"
+	"microcoin/internal/limitbook"
 	"microcoin/internal/models"
 	"microcoin/internal/orders"
+	"microcoin/internal/portfolio"
 	"microcoin/internal/quotes"
 	"microcoin/internal/rate"
 
@@ -26,7 +32,6 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
-	"github.com/shopspring/decimal"
 )
 
 var (
@@ -63,6 +68,8 @@ func main() {
 	orderService := orders.NewService(db, quotesService)
 	ledgerService := ledger.NewService(db)
 	idempotencyService := idempotency.NewService(db)
+	portfolioService := portfolio.NewService(db, quotesService)
+	algoService := algo.NewService(db, orderService, quotesService)
 
 	// Initialize rate limiter
 	var rateLimiter *rate.Limiter
@@ -71,10 +78,22 @@ func main() {
 	}
 
 	// Start quotes service
-	if err := quotesService.Start(ctx); err != nil {
+	if err := quotesService.Start(ctx, orderService.Instruments().Symbols()); err != nil {
 		log.Fatalf("Failed to start quotes service: %v", err)
 	}
 
+	// Expire old idempotency keys
+	idempotencyService.StartExpirer(ctx, time.Hour)
+
+	// Expire good-till-date orders
+	orderService.StartExpirer(ctx, time.Second)
+
+	// Trigger stop orders as quotes arrive
+	orderService.StartStopWatcher(ctx)
+
+	// Send due algo order slices
+	algoService.Start(ctx, time.Second)
+
 	// Setup HTTP server
 	router := mux.NewRouter()
 
@@ -102,14 +121,35 @@ func main() {
 
 	// Protected routes
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	apiRouter.HandleFunc("/fund/topup", topupHandler(db, ledgerService, idempotencyService)).Methods("POST")
+	apiRouter.HandleFunc("/fund/topup", idempotency.IdempotentHandler(topupHandler(ledgerService), idempotencyService)).Methods("POST")
 	apiRouter.HandleFunc("/quotes", quotesHandler(quotesService)).Methods("GET")
-	apiRouter.HandleFunc("/orders", createOrderHandler(db, orderService, idempotencyService)).Methods("POST")
+	apiRouter.HandleFunc("/instruments", instrumentsHandler(orderService.Instruments())).Methods("GET")
+	apiRouter.HandleFunc("/book/{symbol}", bookHandler(orderService)).Methods("GET")
+	apiRouter.HandleFunc("/orders", createOrderHandler(orderService, idempotencyService)).Methods("POST")
+	apiRouter.HandleFunc("/orders", listOrdersHandler(orderService)).Methods("GET")
 	apiRouter.HandleFunc("/orders/{id}", getOrderHandler(orderService)).Methods("GET")
-	apiRouter.HandleFunc("/portfolio", portfolioHandler(db, orderService)).Methods("GET")
+	apiRouter.HandleFunc("/orders/{id}", amendOrderHandler(orderService)).Methods("PATCH")
+	apiRouter.HandleFunc("/orders/{id}", cancelOrderHandler(orderService)).Methods("DELETE")
+	apiRouter.HandleFunc("/orders/{id}/fills", orderFillsHandler(orderService)).Methods("GET")
+	apiRouter.HandleFunc("/fills", fillsHandler(orderService)).Methods("GET")
+	apiRouter.HandleFunc("/portfolio", portfolioHandler(portfolioService)).Methods("GET")
+	apiRouter.HandleFunc("/algos", idempotency.IdempotentHandler(createAlgoHandler(algoService), idempotencyService)).Methods("POST")
+	apiRouter.HandleFunc("/algos", listAlgosHandler(algoService)).Methods("GET")
+	apiRouter.HandleFunc("/algos/{id}", getAlgoHandler(algoService)).Methods("GET")
+	apiRouter.HandleFunc("/algos/{id}", cancelAlgoHandler(algoService)).Methods("DELETE")
+
+	// Admin routes, only served when an admin key is configured
+	if adminKey := os.Getenv(auth.AdminKeyEnv); adminKey != "" {
+		adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+		adminRouter.Use(auth.AdminMiddleware(adminKey))
+		adminRouter.HandleFunc("/reconcile", reconcileHandler(ledgerService)).Methods("GET", "POST")
+	} else {
+		log.Printf("%s is not set; admin routes are disabled", auth.AdminKeyEnv)
+	}
 
 	// WebSocket routes
-	router.HandleFunc("/ws/quotes", websocketQuotesHandler(quotesService))
+	router.HandleFunc("/ws/quotes", websocketQuotesHandler(quotesService, orderService.Instruments().Symbols()))
+	router.HandleFunc("/ws/book", websocketBookHandler(orderService))
 
 	// Start server
 	server := &http.Server{
@@ -147,8 +187,8 @@ func main() {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, X-Admin-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -255,7 +295,102 @@ func loginHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func topupHandler(db *sql.DB, ledgerService *ledger.Service, idempotencyService *idempotency.Service) http.HandlerFunc {
+func topupHandler(ledgerService *ledger.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		// Parse request
+		var req models.TopUpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Process top-up in the idempotency transaction so the key commits with it
+		tx, ok := idempotency.TxFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Idempotency transaction missing", http.StatusInternalServerError)
+			return
+		}
+
+		account, err := ledgerService.TopUpUserTx(tx, userID, req.Amount)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to top up: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Create response
+		response := models.TopUpResponse{
+			Balance: account.BalanceAvailable,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func quotesHandler(quotesService *quotes.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := r.URL.Query().Get("symbol")
+		if symbol == "" {
+			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
+			return
+		}
+
+		quote, err := quotesService.GetQuote(models.Symbol(symbol))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get quote: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+func instrumentsHandler(registry *instruments.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(registry.List())
+	}
+}
+
+func bookHandler(orderService *orders.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := models.Symbol(mux.Vars(r)["symbol"])
+
+		depth := orders.DefaultBookDepth
+		if value := r.URL.Query().Get("depth"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 || parsed > orders.MaxBookDepth {
+				http.Error(w, fmt.Sprintf("invalid depth: %s", value), http.StatusBadRequest)
+				return
+			}
+			depth = parsed
+		}
+
+		snapshot, err := orderService.BookSnapshot(symbol, depth)
+		if err != nil {
+			if errors.Is(err, instruments.ErrUnknownSymbol) {
+				writeErrorResponse(w, http.StatusNotFound, models.ErrorCodeInvalidSymbol, err.Error())
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to get order book: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	}
+}
+
+func createOrderHandler(orderService *orders.Service, idempotencyService *idempotency.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get user ID from context
 		userID, ok := auth.GetUserIDFromContext(r.Context())
@@ -278,6 +413,13 @@ func topupHandler(db *sql.DB, ledgerService *ledger.Service, idempotencyService
 			return
 		}
 
+		// Parse request
+		var req models.CreateOrderRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
 		// Generate fingerprint
 		headers := make(map[string]string)
 		for key, values := range r.Header {
@@ -287,89 +429,256 @@ func topupHandler(db *sql.DB, ledgerService *ledger.Service, idempotencyService
 		}
 		fingerprint := idempotencyService.GenerateFingerprint(body, headers)
 
-		// Check idempotency
-		existingKey, err := idempotencyService.CheckIdempotency(userID, idemKey, fingerprint)
+		// Claim the key, or replay the stored response
+		claim, err := idempotencyService.Begin(userID, idemKey, fingerprint)
 		if err != nil {
-			http.Error(w, "Idempotency key mismatch", http.StatusConflict)
+			idempotency.WriteError(w, err)
+			return
+		}
+		if claim.Status == models.IdempotencyStatusCompleted {
+			idempotency.Replay(w, claim)
 			return
 		}
 
-		// If we have a cached response, return it
-		if existingKey != nil {
-			w.WriteHeader(existingKey.ResponseCode)
-			w.Write(existingKey.ResponseBody)
+		// Create order; the response is stored in the placement transaction.
+		// Order placement commits under the book lock, so it owns the transaction.
+		var responseBody []byte
+		_, err = orderService.CreateOrderWithRecord(userID, &req, func(tx *sql.Tx, response *models.CreateOrderResponse) error {
+			marshaled, err := json.Marshal(response)
+			if err != nil {
+				return fmt.Errorf("failed to marshal response: %w", err)
+			}
+			responseBody = marshaled
+			return idempotencyService.Complete(tx, claim, http.StatusOK, responseBody)
+		})
+		if err != nil {
+			idempotencyService.Release(claim)
+			switch {
+			case errors.Is(err, orders.ErrNoQuote):
+				http.Error(w, "No quote available to price order", http.StatusServiceUnavailable)
+			case errors.Is(err, orders.ErrPostOnlyWouldCross):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodePostOnlyCross, err.Error())
+			case errors.Is(err, orders.ErrReduceOnlyExceedsPosition):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodeReduceOnly, err.Error())
+			case errors.Is(err, orders.ErrStopWouldTrigger):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodeStopWouldTrigger, err.Error())
+			case errors.Is(err, instruments.ErrUnknownSymbol):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidSymbol, err.Error())
+			case errors.Is(err, orders.ErrInstrumentNotTrading):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodeNotTrading, err.Error())
+			case errors.Is(err, instruments.ErrInvalidTickSize):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidTickSize, err.Error())
+			case errors.Is(err, instruments.ErrInvalidLotSize):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidLotSize, err.Error())
+			case errors.Is(err, instruments.ErrBelowMinNotional):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeMinNotional, err.Error())
+			default:
+				http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
-		// Parse request
-		var req models.TopUpRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(responseBody)
+	}
+}
+
+// writeErrorResponse writes a coded JSON error
+func writeErrorResponse(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Error: models.ErrorDetail{
+			Code:      code,
+			Message:   message,
+			RequestID: uuid.New().String(),
+		},
+	})
+}
+
+func listOrdersHandler(orderService *orders.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		// Process top-up
-		account, err := ledgerService.TopUpUser(userID, req.Amount)
+		req, err := parseListOrdersRequest(r)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to top up: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Create response
-		response := models.TopUpResponse{
-			Balance: account.BalanceAvailable,
+		response, err := orderService.ListOrders(userID, req)
+		if err != nil {
+			if errors.Is(err, orders.ErrInvalidCursor) {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Failed to list orders", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// parseListOrdersRequest reads order history filters from the query string
+func parseListOrdersRequest(r *http.Request) (*models.ListOrdersRequest, error) {
+	query := r.URL.Query()
+	req := &models.ListOrdersRequest{
+		Cursor: query.Get("cursor"),
+	}
+
+	if symbol := query.Get("symbol"); symbol != "" {
+		value := models.Symbol(symbol)
+		req.Symbol = &value
+	}
+
+	if side := query.Get("side"); side != "" {
+		value := models.OrderSide(side)
+		if value != models.OrderSideBuy && value != models.OrderSideSell {
+			return nil, fmt.Errorf("invalid side: %s", side)
 		}
+		req.Side = &value
+	}
+
+	if status := query.Get("status"); status != "" {
+		value := models.OrderStatus(status)
+		switch value {
+		case models.OrderStatusNew, models.OrderStatusPartiallyFilled, models.OrderStatusFilled,
+			models.OrderStatusCanceled, models.OrderStatusRejected, models.OrderStatusExpired,
+			models.OrderStatusPending:
+		default:
+			return nil, fmt.Errorf("invalid status: %s", status)
+		}
+		req.Status = &value
+	}
+
+	if orderType := query.Get("type"); orderType != "" {
+		value := models.OrderType(orderType)
+		switch value {
+		case models.OrderTypeMarket, models.OrderTypeLimit, models.OrderTypeStopMarket, models.OrderTypeStopLimit,
+			models.OrderTypeTrailingStop:
+		default:
+			return nil, fmt.Errorf("invalid type: %s", orderType)
+		}
+		req.Type = &value
+	}
 
-		responseBody, err := json.Marshal(response)
+	if from := query.Get("from"); from != "" {
+		value, err := time.Parse(time.RFC3339, from)
 		if err != nil {
-			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("invalid from timestamp: %s", from)
+		}
+		req.CreatedFrom = &value
+	}
+
+	if to := query.Get("to"); to != "" {
+		value, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to timestamp: %s", to)
 		}
+		req.CreatedTo = &value
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid limit: %s", limit)
+		}
+		req.Limit = value
+	}
+
+	return req, nil
+}
 
-		// Store idempotency key
-		tx, err := db.Begin()
+func getOrderHandler(orderService *orders.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		orderID, err := uuid.Parse(vars["id"])
 		if err != nil {
-			http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+			http.Error(w, "Invalid order ID", http.StatusBadRequest)
 			return
 		}
-		defer tx.Rollback()
 
-		if err := idempotencyService.StoreIdempotency(tx, userID, idemKey, fingerprint, http.StatusOK, responseBody); err != nil {
-			http.Error(w, "Failed to store idempotency key", http.StatusInternalServerError)
+		order, err := orderService.GetOrder(orderID)
+		if err != nil {
+			http.Error(w, "Order not found", http.StatusNotFound)
 			return
 		}
 
-		if err := tx.Commit(); err != nil {
-			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		// Bracket orders show their entry and take-profit/stop-loss legs
+		group, err := orderService.GetOrderGroup(orderID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get order group: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(responseBody)
+		json.NewEncoder(w).Encode(models.OrderDetailResponse{Order: *order, Group: group})
 	}
 }
 
-func quotesHandler(quotesService *quotes.Service) http.HandlerFunc {
+func amendOrderHandler(orderService *orders.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		symbol := r.URL.Query().Get("symbol")
-		if symbol == "" {
-			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		quote, err := quotesService.GetQuote(models.Symbol(symbol))
+		vars := mux.Vars(r)
+		orderID, err := uuid.Parse(vars["id"])
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get quote: %v", err), http.StatusInternalServerError)
+			http.Error(w, "Invalid order ID", http.StatusBadRequest)
+			return
+		}
+
+		var req models.AmendOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		order, err := orderService.AmendOrder(userID, orderID, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, orders.ErrInvalidAmendment):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, instruments.ErrInvalidTickSize):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidTickSize, err.Error())
+			case errors.Is(err, instruments.ErrInvalidLotSize):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidLotSize, err.Error())
+			case errors.Is(err, instruments.ErrBelowMinNotional):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeMinNotional, err.Error())
+			case errors.Is(err, orders.ErrPostOnlyWouldCross):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodePostOnlyCross, err.Error())
+			case errors.Is(err, orders.ErrReduceOnlyExceedsPosition):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodeReduceOnly, err.Error())
+			case errors.Is(err, orders.ErrOrderNotFound):
+				http.Error(w, "Order not found", http.StatusNotFound)
+			case errors.Is(err, orders.ErrOrderNotOwned):
+				http.Error(w, "Order belongs to another user", http.StatusForbidden)
+			case errors.Is(err, orders.ErrOrderNotOpen):
+				http.Error(w, "Order is not open", http.StatusConflict)
+			default:
+				http.Error(w, fmt.Sprintf("Failed to amend order: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(quote)
+		json.NewEncoder(w).Encode(order)
 	}
 }
 
-func createOrderHandler(db *sql.DB, orderService *orders.Service, idempotencyService *idempotency.Service) http.HandlerFunc {
+func cancelOrderHandler(orderService *orders.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get user ID from context
 		userID, ok := auth.GetUserIDFromContext(r.Context())
@@ -378,108 +687,201 @@ func createOrderHandler(db *sql.DB, orderService *orders.Service, idempotencySer
 			return
 		}
 
-		// Get idempotency key
-		idemKey := r.Header.Get("Idempotency-Key")
-		if idemKey == "" {
-			http.Error(w, "Idempotency-Key header required", http.StatusBadRequest)
+		vars := mux.Vars(r)
+		orderID, err := uuid.Parse(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid order ID", http.StatusBadRequest)
 			return
 		}
 
-		// Read request body
-		body, err := io.ReadAll(r.Body)
+		order, err := orderService.CancelOrder(userID, orderID)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			switch {
+			case errors.Is(err, orders.ErrOrderNotFound):
+				http.Error(w, "Order not found", http.StatusNotFound)
+			case errors.Is(err, orders.ErrOrderNotOwned):
+				http.Error(w, "Order belongs to another user", http.StatusForbidden)
+			case errors.Is(err, orders.ErrOrderNotOpen):
+				http.Error(w, "Order is not open", http.StatusConflict)
+			default:
+				http.Error(w, fmt.Sprintf("Failed to cancel order: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
-		// Generate fingerprint
-		headers := make(map[string]string)
-		for key, values := range r.Header {
-			if len(values) > 0 {
-				headers[key] = values[0]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(order)
+	}
+}
+
+func fillsHandler(orderService *orders.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, fmt.Sprintf("invalid limit: %s", value), http.StatusBadRequest)
+				return
 			}
+			limit = parsed
 		}
-		fingerprint := idempotencyService.GenerateFingerprint(body, headers)
 
-		// Check idempotency
-		existingKey, err := idempotencyService.CheckIdempotency(userID, idemKey, fingerprint)
+		fills, err := orderService.GetFills(userID, limit)
 		if err != nil {
-			http.Error(w, "Idempotency key mismatch", http.StatusConflict)
+			http.Error(w, fmt.Sprintf("Failed to get fills: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		// If we have a cached response, return it
-		if existingKey != nil {
-			w.WriteHeader(existingKey.ResponseCode)
-			w.Write(existingKey.ResponseBody)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fills)
+	}
+}
+
+func orderFillsHandler(orderService *orders.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		// Parse request
-		var req models.CreateOrderRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		vars := mux.Vars(r)
+		orderID, err := uuid.Parse(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid order ID", http.StatusBadRequest)
 			return
 		}
 
-		// Create order
-		response, err := orderService.CreateOrder(userID, &req)
+		fills, err := orderService.GetOrderFills(userID, orderID)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
+			switch {
+			case errors.Is(err, orders.ErrOrderNotFound):
+				http.Error(w, "Order not found", http.StatusNotFound)
+			case errors.Is(err, orders.ErrOrderNotOwned):
+				http.Error(w, "Order belongs to another user", http.StatusForbidden)
+			default:
+				http.Error(w, fmt.Sprintf("Failed to get fills: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
-		responseBody, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fills)
+	}
+}
+
+func createAlgoHandler(algoService *algo.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
 			return
 		}
 
-		// Store idempotency key
-		tx, err := db.Begin()
-		if err != nil {
-			http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+		var req models.CreateAlgoOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		defer tx.Rollback()
 
-		if err := idempotencyService.StoreIdempotency(tx, userID, idemKey, fingerprint, http.StatusOK, responseBody); err != nil {
-			http.Error(w, "Failed to store idempotency key", http.StatusInternalServerError)
+		// Schedule in the idempotency transaction so the key commits with it
+		tx, ok := idempotency.TxFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Idempotency transaction missing", http.StatusInternalServerError)
 			return
 		}
 
-		if err := tx.Commit(); err != nil {
-			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		algoOrder, err := algoService.CreateTx(tx, userID, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, algo.ErrInvalidAlgoOrder):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, orders.ErrNoQuote):
+				http.Error(w, "No quote available to price order", http.StatusServiceUnavailable)
+			case errors.Is(err, instruments.ErrUnknownSymbol):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidSymbol, err.Error())
+			case errors.Is(err, orders.ErrInstrumentNotTrading):
+				writeErrorResponse(w, http.StatusUnprocessableEntity, models.ErrorCodeNotTrading, err.Error())
+			case errors.Is(err, instruments.ErrInvalidTickSize):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidTickSize, err.Error())
+			case errors.Is(err, instruments.ErrInvalidLotSize):
+				writeErrorResponse(w, http.StatusBadRequest, models.ErrorCodeInvalidLotSize, err.Error())
+			default:
+				http.Error(w, fmt.Sprintf("Failed to create algo order: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write(responseBody)
+		json.NewEncoder(w).Encode(algoOrder)
 	}
 }
 
-func getOrderHandler(orderService *orders.Service) http.HandlerFunc {
+func listAlgosHandler(algoService *algo.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		algoOrders, err := algoService.List(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list algo orders: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(algoOrders)
+	}
+}
+
+func getAlgoHandler(algoService *algo.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
 		vars := mux.Vars(r)
-		orderID, err := uuid.Parse(vars["id"])
+		algoID, err := uuid.Parse(vars["id"])
 		if err != nil {
-			http.Error(w, "Invalid order ID", http.StatusBadRequest)
+			http.Error(w, "Invalid algo order ID", http.StatusBadRequest)
 			return
 		}
 
-		order, err := orderService.GetOrder(orderID)
+		detail, err := algoService.Get(userID, algoID)
 		if err != nil {
-			http.Error(w, "Order not found", http.StatusNotFound)
+			switch {
+			case errors.Is(err, algo.ErrAlgoNotFound):
+				http.Error(w, "Algo order not found", http.StatusNotFound)
+			case errors.Is(err, algo.ErrAlgoNotOwned):
+				http.Error(w, "Algo order belongs to another user", http.StatusForbidden)
+			default:
+				http.Error(w, fmt.Sprintf("Failed to get algo order: %v", err), http.StatusInternalServerError)
+			}
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(order)
+		json.NewEncoder(w).Encode(detail)
 	}
 }
 
-func portfolioHandler(db *sql.DB, orderService *orders.Service) http.HandlerFunc {
+func cancelAlgoHandler(algoService *algo.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get user ID from context
 		userID, ok := auth.GetUserIDFromContext(r.Context())
@@ -488,42 +890,70 @@ func portfolioHandler(db *sql.DB, orderService *orders.Service) http.HandlerFunc
 			return
 		}
 
-		// Get accounts
-		accountRepo := database.NewAccountRepository(db)
-		accounts, err := accountRepo.GetAccountsByUserID(userID)
+		vars := mux.Vars(r)
+		algoID, err := uuid.Parse(vars["id"])
 		if err != nil {
-			http.Error(w, "Failed to get accounts", http.StatusInternalServerError)
+			http.Error(w, "Invalid algo order ID", http.StatusBadRequest)
 			return
 		}
 
-		// Convert to portfolio format
-		var balances []models.AccountBalance
-		for _, account := range accounts {
-			balance := models.AccountBalance{
-				Currency:         account.Currency,
-				BalanceAvailable: account.BalanceAvailable,
-				BalanceHold:      account.BalanceHold,
-				BalanceTotal:     account.BalanceAvailable.Add(account.BalanceHold),
+		algoOrder, err := algoService.Cancel(userID, algoID)
+		if err != nil {
+			switch {
+			case errors.Is(err, algo.ErrAlgoNotFound):
+				http.Error(w, "Algo order not found", http.StatusNotFound)
+			case errors.Is(err, algo.ErrAlgoNotOwned):
+				http.Error(w, "Algo order belongs to another user", http.StatusForbidden)
+			case errors.Is(err, algo.ErrAlgoNotRunning):
+				http.Error(w, "Algo order is not running", http.StatusConflict)
+			default:
+				http.Error(w, fmt.Sprintf("Failed to cancel algo order: %v", err), http.StatusInternalServerError)
 			}
-			balances = append(balances, balance)
+			return
 		}
 
-		portfolio := models.Portfolio{
-			Balances:  balances,
-			Positions: []models.Position{}, // TODO: Calculate positions
-			PnL: models.PnL{
-				Realized:   decimal.Zero,
-				Unrealized: decimal.Zero,
-				Total:      decimal.Zero,
-			},
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(algoOrder)
+	}
+}
+
+func portfolioHandler(portfolioService *portfolio.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get user ID from context
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "User not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		userPortfolio, err := portfolioService.GetPortfolio(userID)
+		if err != nil {
+			http.Error(w, "Failed to get portfolio", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userPortfolio)
+	}
+}
+
+func reconcileHandler(ledgerService *ledger.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// GET only reports; POST also repairs mismatched balances
+		repair := r.Method == http.MethodPost
+
+		report, err := ledgerService.Reconcile(repair)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to reconcile ledger: %v", err), http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(portfolio)
+		json.NewEncoder(w).Encode(report)
 	}
 }
 
-func websocketQuotesHandler(quotesService *quotes.Service) http.HandlerFunc {
+func websocketQuotesHandler(quotesService *quotes.Service, symbols []models.Symbol) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -532,26 +962,171 @@ func websocketQuotesHandler(quotesService *quotes.Service) http.HandlerFunc {
 		}
 		defer conn.Close()
 
-		// Subscribe to all symbols
-		btcCh := quotesService.Subscribe(models.SymbolBTCUSD)
-		ethCh := quotesService.Subscribe(models.SymbolETHUSD)
-
-		defer quotesService.Unsubscribe(models.SymbolBTCUSD, btcCh)
-		defer quotesService.Unsubscribe(models.SymbolETHUSD, ethCh)
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// Subscribe to all symbols and merge their quotes into one stream
+		merged := make(chan *models.Quote, 10)
+		for _, symbol := range symbols {
+			ch := quotesService.Subscribe(symbol)
+			defer quotesService.Unsubscribe(symbol, ch)
+
+			go func(ch <-chan *models.Quote) {
+				for quote := range ch {
+					select {
+					case merged <- quote:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(ch)
+		}
 
 		// Send quotes to client
 		for {
 			select {
-			case quote := <-btcCh:
+			case <-ctx.Done():
+				return
+			case quote := <-merged:
 				if err := conn.WriteJSON(quote); err != nil {
-					log.Printf("Failed to write BTC quote: %v", err)
+					log.Printf("Failed to write %s quote: %v", quote.Symbol, err)
 					return
 				}
-			case quote := <-ethCh:
-				if err := conn.WriteJSON(quote); err != nil {
-					log.Printf("Failed to write ETH quote: %v", err)
+			}
+		}
+	}
+}
+
+// bookMessage is a /ws/book frame: a full "snapshot" of the book or an incremental
+// "update" of the price levels one change touched
+type bookMessage struct {
+	Type     string                 `json:"type"`
+	Symbol   models.Symbol          `json:"symbol"`
+	Sequence uint64                 `json:"sequence"`
+	Bids     []limitbook.DepthLevel `json:"bids"`
+	Asks     []limitbook.DepthLevel `json:"asks"`
+}
+
+// websocketBookHandler streams a symbol's order book: a snapshot on subscribe, then
+// one update per change, each one sequence number after the last. When updates
+// were dropped for a slow connection a fresh snapshot is sent in their place, and
+// a client that sees a gap can ask for one with {"type":"resync"}.
+func websocketBookHandler(orderService *orders.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := models.Symbol(r.URL.Query().Get("symbol"))
+		if symbol == "" {
+			http.Error(w, "Symbol parameter required", http.StatusBadRequest)
+			return
+		}
+
+		updates, snapshot, err := orderService.SubscribeBook(symbol)
+		if err != nil {
+			if errors.Is(err, instruments.ErrUnknownSymbol) {
+				writeErrorResponse(w, http.StatusNotFound, models.ErrorCodeInvalidSymbol, err.Error())
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to subscribe to order book: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer orderService.UnsubscribeBook(symbol, updates)
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// Read resync requests until the client goes away
+		resync := make(chan struct{}, 1)
+		go func() {
+			defer cancel()
+			for {
+				var request struct {
+					Type string `json:"type"`
+				}
+				if err := conn.ReadJSON(&request); err != nil {
+					return
+				}
+				if request.Type == "resync" {
+					select {
+					case resync <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+
+		sendSnapshot := func(snapshot *limitbook.Snapshot) bool {
+			err := conn.WriteJSON(bookMessage{
+				Type:     "snapshot",
+				Symbol:   snapshot.Symbol,
+				Sequence: snapshot.Sequence,
+				Bids:     snapshot.Bids,
+				Asks:     snapshot.Asks,
+			})
+			if err != nil {
+				log.Printf("Failed to write %s book snapshot: %v", symbol, err)
+				return false
+			}
+			return true
+		}
+		resend := func() (uint64, bool) {
+			snapshot, err := orderService.BookSnapshot(symbol, 0)
+			if err != nil {
+				log.Printf("Failed to get %s book snapshot: %v", symbol, err)
+				return 0, false
+			}
+			return snapshot.Sequence, sendSnapshot(snapshot)
+		}
+
+		if !sendSnapshot(snapshot) {
+			return
+		}
+		sequence := snapshot.Sequence
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-resync:
+				var ok bool
+				if sequence, ok = resend(); !ok {
+					return
+				}
+			case update, open := <-updates:
+				if !open {
+					return
+				}
+
+				// Updates already covered by the last snapshot are skipped; a gap
+				// means updates were dropped, so the client gets a fresh snapshot
+				if update.Sequence <= sequence {
+					continue
+				}
+				if update.Sequence != sequence+1 {
+					var ok bool
+					if sequence, ok = resend(); !ok {
+						return
+					}
+					continue
+				}
+
+				err := conn.WriteJSON(bookMessage{
+					Type:     "update",
+					Symbol:   update.Symbol,
+					Sequence: update.Sequence,
+					Bids:     update.Bids,
+					Asks:     update.Asks,
+				})
+				if err != nil {
+					log.Printf("Failed to write %s book update: %v", symbol, err)
 					return
 				}
+				sequence = update.Sequence
 			}
 		}
 	}
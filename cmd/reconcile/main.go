@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"microcoin/internal/database"
+	"microcoin/internal/ledger"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "rebuild mismatched available balances from the ledger")
+	flag.Parse()
+
+	// Initialize database
+	db, err := database.Connect(database.DefaultConfig())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close(db)
+
+	ledgerService := ledger.NewService(db)
+
+	report, err := ledgerService.Reconcile(*repair)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	log.Printf("Checked %d accounts and %d journals: %d discrepancies, %d unbalanced journals",
+		report.AccountsChecked, report.JournalsChecked, len(report.Discrepancies), len(report.UnbalancedJournals))
+
+	if !report.OK() {
+		database.Close(db)
+		os.Exit(1)
+	}
+}
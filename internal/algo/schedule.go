@@ -0,0 +1,41 @@
+package algo
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// EvenWeights returns n equal weights, the TWAP profile
+func EvenWeights(n int) []decimal.Decimal {
+	weights := make([]decimal.Decimal, n)
+	for i := range weights {
+		weights[i] = decimal.NewFromInt(1)
+	}
+	return weights
+}
+
+// Schedule spreads qty over one slice per weight in proportion to the weights and
+// returns the cumulative quantity due after each slice. Targets are rounded down to
+// whole lots, so rounding carries into later slices and the last target is qty.
+// Weights that sum to zero are spread evenly.
+func Schedule(qty decimal.Decimal, weights []decimal.Decimal, lotSize decimal.Decimal) []decimal.Decimal {
+	total := decimal.Zero
+	for _, weight := range weights {
+		total = total.Add(weight)
+	}
+	if !total.IsPositive() {
+		weights = EvenWeights(len(weights))
+		total = decimal.NewFromInt(int64(len(weights)))
+	}
+
+	targets := make([]decimal.Decimal, len(weights))
+	cumulative := decimal.Zero
+	for i, weight := range weights {
+		cumulative = cumulative.Add(weight)
+		targets[i] = qty.Mul(cumulative).Div(total).Div(lotSize).Floor().Mul(lotSize)
+	}
+	if len(targets) > 0 {
+		targets[len(targets)-1] = qty
+	}
+
+	return targets
+}
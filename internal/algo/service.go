@@ -0,0 +1,474 @@
+package algo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"microcoin/internal/database"
+	"microcoin/internal/instruments"
+	"microcoin/internal/models"
+	"microcoin/internal/orders"
+	"microcoin/internal/quotes"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrAlgoNotFound is returned when an algo order does not exist
+	ErrAlgoNotFound = errors.New("algo order not found")
+	// ErrAlgoNotOwned is returned when a user acts on another user's algo order
+	ErrAlgoNotOwned = errors.New("algo order belongs to another user")
+	// ErrAlgoNotRunning is returned when an algo order has already finished
+	ErrAlgoNotRunning = errors.New("algo order is not running")
+	// ErrInvalidAlgoOrder is returned when an algo order request cannot be scheduled
+	ErrInvalidAlgoOrder = errors.New("invalid algo order")
+)
+
+const (
+	// MaxDuration caps how long an algo order may run
+	MaxDuration = 24 * time.Hour
+	// MaxSlices caps how many child orders an algo order may be split into
+	MaxSlices = 1440
+	// DefaultSliceInterval sets the slice count when none is requested
+	DefaultSliceInterval = time.Minute
+	// ProfileLookback is how far back VWAP looks for traded volume by time of day
+	ProfileLookback = 7 * 24 * time.Hour
+)
+
+// Service runs algo parent orders, submitting their slices as market child
+// orders through the order service as they fall due. A slice trades the gap
+// between its cumulative target and what the parent has filled, so slices that
+// are skipped or fail roll into the next one.
+type Service struct {
+	db            *sql.DB
+	algoRepo      *database.AlgoRepository
+	tradeRepo     *database.TradeRepository
+	orderService  *orders.Service
+	quotesService *quotes.Service
+	mutex         sync.Mutex
+}
+
+// NewService creates a new algo service
+func NewService(db *sql.DB, orderService *orders.Service, quotesService *quotes.Service) *Service {
+	return &Service{
+		db:            db,
+		algoRepo:      database.NewAlgoRepository(db),
+		tradeRepo:     database.NewTradeRepository(db),
+		orderService:  orderService,
+		quotesService: quotesService,
+	}
+}
+
+// Create schedules an algo order
+func (s *Service) Create(userID uuid.UUID, req *models.CreateAlgoOrderRequest) (*models.AlgoOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	algo, err := s.CreateTx(tx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return algo, nil
+}
+
+// CreateTx schedules an algo order within the caller's transaction. The first
+// slice is due at once and the rest at even intervals over the duration.
+func (s *Service) CreateTx(tx *sql.Tx, userID uuid.UUID, req *models.CreateAlgoOrderRequest) (*models.AlgoOrder, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	instrument, err := s.orderService.Instruments().Get(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	if instrument.Status != models.InstrumentStatusTrading {
+		return nil, fmt.Errorf("%w: %s is %s", orders.ErrInstrumentNotTrading, req.Symbol, instrument.Status)
+	}
+	if err := instruments.CheckQty(instrument, req.Qty); err != nil {
+		return nil, err
+	}
+	if req.LimitPrice != nil {
+		if err := instruments.CheckPrice(instrument, *req.LimitPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	// Slippage is measured against the mid when the parent arrives
+	if s.quotesService == nil {
+		return nil, orders.ErrNoQuote
+	}
+	quote, err := s.quotesService.GetQuote(req.Symbol)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", orders.ErrNoQuote, err)
+	}
+	arrivalPrice := quote.Bid.Add(quote.Ask).Div(decimal.NewFromInt(2))
+
+	now := time.Now()
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	interval := duration / time.Duration(req.Slices)
+
+	weights := EvenWeights(req.Slices)
+	if req.Strategy == models.AlgoStrategyVWAP {
+		weights = req.VolumeProfile
+		if weights == nil {
+			weights, err = s.tradeRepo.GetVolumeProfile(req.Symbol, now, interval, req.Slices, ProfileLookback)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	algo := &models.AlgoOrder{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Symbol:       req.Symbol,
+		Side:         req.Side,
+		Strategy:     req.Strategy,
+		Qty:          req.Qty,
+		LimitPrice:   req.LimitPrice,
+		ArrivalPrice: arrivalPrice,
+		Status:       models.AlgoStatusRunning,
+		StartAt:      now,
+		EndAt:        now.Add(duration),
+		CreatedAt:    now,
+	}
+
+	targets := Schedule(req.Qty, weights, instrument.LotSize)
+	slices := make([]models.AlgoSlice, len(targets))
+	for i, target := range targets {
+		slices[i] = models.AlgoSlice{
+			AlgoID:    algo.ID,
+			Slice:     i + 1,
+			DueAt:     now.Add(time.Duration(i) * interval),
+			TargetQty: target,
+		}
+	}
+
+	if err := s.algoRepo.CreateAlgoOrder(tx, algo, slices); err != nil {
+		return nil, err
+	}
+
+	return algo, nil
+}
+
+// validateRequest checks an algo order request and fills in the default slice count
+func validateRequest(req *models.CreateAlgoOrderRequest) error {
+	if req.Side != models.OrderSideBuy && req.Side != models.OrderSideSell {
+		return fmt.Errorf("%w: side must be BUY or SELL", ErrInvalidAlgoOrder)
+	}
+	if req.Strategy != models.AlgoStrategyTWAP && req.Strategy != models.AlgoStrategyVWAP {
+		return fmt.Errorf("%w: strategy must be TWAP or VWAP", ErrInvalidAlgoOrder)
+	}
+	if !req.Qty.IsPositive() {
+		return fmt.Errorf("%w: quantity must be positive", ErrInvalidAlgoOrder)
+	}
+	if req.LimitPrice != nil && !req.LimitPrice.IsPositive() {
+		return fmt.Errorf("%w: limit_price must be positive", ErrInvalidAlgoOrder)
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	if req.DurationSeconds <= 0 || duration > MaxDuration {
+		return fmt.Errorf("%w: duration_seconds must be between 1 and %d", ErrInvalidAlgoOrder, int(MaxDuration.Seconds()))
+	}
+
+	if req.Slices == 0 {
+		req.Slices = int(duration / DefaultSliceInterval)
+		if req.Slices < 1 {
+			req.Slices = 1
+		}
+	}
+	if req.Slices < 1 || req.Slices > MaxSlices || req.Slices > req.DurationSeconds {
+		return fmt.Errorf("%w: slices must be between 1 and %d, and at most one per second", ErrInvalidAlgoOrder, MaxSlices)
+	}
+
+	if req.VolumeProfile != nil {
+		if req.Strategy != models.AlgoStrategyVWAP {
+			return fmt.Errorf("%w: volume_profile is only valid for VWAP", ErrInvalidAlgoOrder)
+		}
+		if len(req.VolumeProfile) != req.Slices {
+			return fmt.Errorf("%w: volume_profile must have one weight per slice", ErrInvalidAlgoOrder)
+		}
+		total := decimal.Zero
+		for _, weight := range req.VolumeProfile {
+			if weight.IsNegative() {
+				return fmt.Errorf("%w: volume_profile weights cannot be negative", ErrInvalidAlgoOrder)
+			}
+			total = total.Add(weight)
+		}
+		if !total.IsPositive() {
+			return fmt.Errorf("%w: volume_profile must have a positive weight", ErrInvalidAlgoOrder)
+		}
+	}
+
+	return nil
+}
+
+// Get returns an algo order with its progress, schedule and child orders
+func (s *Service) Get(userID, algoID uuid.UUID) (*models.AlgoOrderDetailResponse, error) {
+	algo, err := s.algoRepo.GetAlgoOrder(algoID)
+	if err != nil {
+		return nil, ErrAlgoNotFound
+	}
+	if algo.UserID != userID {
+		return nil, ErrAlgoNotOwned
+	}
+
+	slices, err := s.algoRepo.GetSlices(algoID)
+	if err != nil {
+		return nil, err
+	}
+
+	children := []models.Order{}
+	for _, slice := range slices {
+		if slice.OrderID == nil {
+			continue
+		}
+		order, err := s.orderService.GetOrder(*slice.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, *order)
+	}
+
+	filledQty, filledValue, err := s.algoRepo.GetFillSummary(algoID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.AlgoOrderDetailResponse{
+		AlgoOrder:    *algo,
+		FilledQty:    filledQty,
+		RemainingQty: algo.Qty.Sub(filledQty),
+		Slices:       slices,
+		Children:     children,
+	}
+
+	if filledQty.IsPositive() {
+		avgPrice := filledValue.Div(filledQty)
+		slippage := Slippage(algo.Side, algo.ArrivalPrice, avgPrice)
+		detail.AvgPrice = &avgPrice
+		detail.SlippageBps = &slippage
+	}
+
+	return detail, nil
+}
+
+// Slippage returns how much worse than the arrival price an average fill price
+// was, in basis points; negative when the fills were better
+func Slippage(side models.OrderSide, arrivalPrice, avgPrice decimal.Decimal) decimal.Decimal {
+	bps := avgPrice.Sub(arrivalPrice).Div(arrivalPrice).Mul(decimal.NewFromInt(10000))
+	if side == models.OrderSideSell {
+		bps = bps.Neg()
+	}
+	return bps.Round(2)
+}
+
+// List returns a user's algo orders, newest first
+func (s *Service) List(userID uuid.UUID) ([]models.AlgoOrder, error) {
+	return s.algoRepo.GetAlgoOrdersByUserID(userID)
+}
+
+// Cancel stops a running algo order. Children already submitted are market
+// orders and have traded; no further slices are sent.
+func (s *Service) Cancel(userID, algoID uuid.UUID) (*models.AlgoOrder, error) {
+	algo, err := s.algoRepo.GetAlgoOrder(algoID)
+	if err != nil {
+		return nil, ErrAlgoNotFound
+	}
+	if algo.UserID != userID {
+		return nil, ErrAlgoNotOwned
+	}
+
+	// Serialize with RunDue so no slice is sent after the cancel returns
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	canceled, err := s.algoRepo.FinishAlgoOrder(algoID, models.AlgoStatusCanceled, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !canceled {
+		return nil, ErrAlgoNotRunning
+	}
+
+	return s.algoRepo.GetAlgoOrder(algoID)
+}
+
+// RunDue submits the latest due slice of every running algo order and finishes
+// the orders that have filled or run out of time. An algo order that fails is
+// logged and retried on the next run. It returns how many child orders were placed.
+func (s *Service) RunDue(now time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	running, err := s.algoRepo.GetRunningAlgoOrders()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range running {
+		placed, err := s.runAlgo(&running[i], now)
+		if err != nil {
+			log.Printf("Failed to run algo order %s: %v", running[i].ID, err)
+			continue
+		}
+		if placed {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// runAlgo advances a single algo order. A slice is left pending while there is
+// no quote, the quote is through the limit price or the quantity due is below
+// the minimum notional, and is retried on the next run.
+func (s *Service) runAlgo(algo *models.AlgoOrder, now time.Time) (bool, error) {
+	filledQty, _, err := s.algoRepo.GetFillSummary(algo.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if filledQty.GreaterThanOrEqual(algo.Qty) {
+		_, err := s.algoRepo.FinishAlgoOrder(algo.ID, models.AlgoStatusCompleted, now)
+		return false, err
+	}
+	if !now.Before(algo.EndAt) {
+		_, err := s.algoRepo.FinishAlgoOrder(algo.ID, models.AlgoStatusExpired, now)
+		return false, err
+	}
+
+	slices, err := s.algoRepo.GetSlices(algo.ID)
+	if err != nil {
+		return false, err
+	}
+
+	// Only the latest due slice is sent; it catches up on any before it
+	var due *models.AlgoSlice
+	for i := range slices {
+		if slices[i].DueAt.After(now) {
+			break
+		}
+		due = &slices[i]
+	}
+	if due == nil || due.SubmittedAt != nil {
+		return false, nil
+	}
+
+	instrument, err := s.orderService.Instruments().Get(algo.Symbol)
+	if err != nil {
+		return false, err
+	}
+
+	qty := due.TargetQty.Sub(filledQty).Div(instrument.LotSize).Floor().Mul(instrument.LotSize)
+	if !qty.IsPositive() {
+		return false, s.recordSlice(algo.ID, due.Slice, nil, now)
+	}
+
+	if s.quotesService == nil {
+		return false, nil
+	}
+	quote, err := s.quotesService.GetQuote(algo.Symbol)
+	if err != nil {
+		return false, nil
+	}
+
+	price := quote.Ask
+	if algo.Side == models.OrderSideSell {
+		price = quote.Bid
+	}
+	if algo.LimitPrice != nil {
+		if algo.Side == models.OrderSideBuy && price.GreaterThan(*algo.LimitPrice) {
+			return false, nil
+		}
+		if algo.Side == models.OrderSideSell && price.LessThan(*algo.LimitPrice) {
+			return false, nil
+		}
+	}
+	if err := instruments.CheckNotional(instrument, price, qty); err != nil {
+		return false, nil
+	}
+
+	req := &models.CreateOrderRequest{
+		Symbol: algo.Symbol,
+		Side:   algo.Side,
+		Type:   models.OrderTypeMarket,
+		Qty:    qty,
+	}
+
+	// The slice is marked in the placement transaction so a child is never sent twice
+	_, err = s.orderService.CreateOrderWithRecord(algo.UserID, req, func(tx *sql.Tx, resp *models.CreateOrderResponse) error {
+		orderID, err := uuid.Parse(resp.OrderID)
+		if err != nil {
+			return fmt.Errorf("failed to parse child order ID: %w", err)
+		}
+		return s.algoRepo.SubmitSlices(tx, algo.ID, due.Slice, &orderID, nil, now)
+	})
+	if err != nil {
+		// The quantity rolls into the next slice
+		log.Printf("Algo order %s slice %d failed: %v", algo.ID, due.Slice, err)
+		return false, s.recordSlice(algo.ID, due.Slice, err, now)
+	}
+
+	return true, nil
+}
+
+// recordSlice marks a slice as run without a child order, noting why if it failed
+func (s *Service) recordSlice(algoID uuid.UUID, slice int, sliceErr error, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var errMsg *string
+	if sliceErr != nil {
+		msg := sliceErr.Error()
+		errMsg = &msg
+	}
+
+	if err := s.algoRepo.SubmitSlices(tx, algoID, slice, nil, errMsg, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Start periodically runs due algo slices until the context is canceled
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if _, err := s.RunDue(now); err != nil {
+					log.Printf("Failed to run algo orders: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -19,6 +19,10 @@ const (
 	RefreshTokenDuration = 7 * 24 * time.Hour
 	JWTSecret            = "microcoin-secret-key-change-in-production"
 
+	// AdminKeyEnv names the environment variable holding the key that guards
+	// operational endpoints such as ledger reconciliation
+	AdminKeyEnv = "ADMIN_KEY"
+
 	// Argon2id settings
 	Memory      = 64 * 1024 // 64 MB
 	Iterations  = 3
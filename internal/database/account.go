@@ -121,3 +121,140 @@ func (r *AccountRepository) GetAccountByID(id uuid.UUID) (*models.Account, error
 
 	return &account, nil
 }
+
+// GetAccountByUserIDAndCurrencyForUpdate retrieves and locks an account within a transaction
+func (r *AccountRepository) GetAccountByUserIDAndCurrencyForUpdate(tx *sql.Tx, userID uuid.UUID, currency models.Currency) (*models.Account, error) {
+	query := `
+		SELECT id, user_id, currency, balance_available, balance_hold
+		FROM accounts
+		WHERE user_id = $1 AND currency = $2
+		FOR UPDATE`
+
+	var account models.Account
+	err := tx.QueryRow(query, userID, currency).Scan(
+		&account.ID,
+		&account.UserID,
+		&account.Currency,
+		&account.BalanceAvailable,
+		&account.BalanceHold,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// GetAccountByIDForUpdate retrieves and locks an account by ID within a transaction
+func (r *AccountRepository) GetAccountByIDForUpdate(tx *sql.Tx, id uuid.UUID) (*models.Account, error) {
+	query := `
+		SELECT id, user_id, currency, balance_available, balance_hold
+		FROM accounts
+		WHERE id = $1
+		FOR UPDATE`
+
+	var account models.Account
+	err := tx.QueryRow(query, id).Scan(
+		&account.ID,
+		&account.UserID,
+		&account.Currency,
+		&account.BalanceAvailable,
+		&account.BalanceHold,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// GetSystemAccount retrieves a system account by code and currency
+func (r *AccountRepository) GetSystemAccount(code models.SystemAccount, currency models.Currency) (*models.Account, error) {
+	query := `
+		SELECT id, currency, balance_available, balance_hold
+		FROM accounts
+		WHERE system_code = $1 AND currency = $2`
+
+	var account models.Account
+	err := r.db.QueryRow(query, code, currency).Scan(
+		&account.ID,
+		&account.Currency,
+		&account.BalanceAvailable,
+		&account.BalanceHold,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("system account not found")
+		}
+		return nil, fmt.Errorf("failed to get system account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// GetSystemAccountForUpdate retrieves and locks a system account within a transaction
+func (r *AccountRepository) GetSystemAccountForUpdate(tx *sql.Tx, code models.SystemAccount, currency models.Currency) (*models.Account, error) {
+	query := `
+		SELECT id, currency, balance_available, balance_hold
+		FROM accounts
+		WHERE system_code = $1 AND currency = $2
+		FOR UPDATE`
+
+	var account models.Account
+	err := tx.QueryRow(query, code, currency).Scan(
+		&account.ID,
+		&account.Currency,
+		&account.BalanceAvailable,
+		&account.BalanceHold,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("system account not found")
+		}
+		return nil, fmt.Errorf("failed to get system account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// GetAllAccounts retrieves every user and system account
+func (r *AccountRepository) GetAllAccounts() ([]models.Account, error) {
+	query := `
+		SELECT id, user_id, currency, balance_available, balance_hold
+		FROM accounts
+		ORDER BY user_id NULLS FIRST, currency`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []models.Account
+	for rows.Next() {
+		var account models.Account
+		err := rows.Scan(
+			&account.ID,
+			&account.UserID,
+			&account.Currency,
+			&account.BalanceAvailable,
+			&account.BalanceHold,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accounts: %w", err)
+	}
+
+	return accounts, nil
+}
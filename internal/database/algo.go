@@ -0,0 +1,253 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AlgoRepository handles algo order database operations
+type AlgoRepository struct {
+	db *sql.DB
+}
+
+// NewAlgoRepository creates a new algo repository
+func NewAlgoRepository(db *sql.DB) *AlgoRepository {
+	return &AlgoRepository{db: db}
+}
+
+// algoColumns lists the algo order columns in the order scanAlgoOrder reads them
+const algoColumns = `id, user_id, symbol, side, strategy, qty, limit_price, arrival_price,
+		status, start_at, end_at, created_at, completed_at`
+
+// scanAlgoOrder scans a row selected with algoColumns
+func scanAlgoOrder(row rowScanner) (*models.AlgoOrder, error) {
+	var algo models.AlgoOrder
+	err := row.Scan(
+		&algo.ID,
+		&algo.UserID,
+		&algo.Symbol,
+		&algo.Side,
+		&algo.Strategy,
+		&algo.Qty,
+		&algo.LimitPrice,
+		&algo.ArrivalPrice,
+		&algo.Status,
+		&algo.StartAt,
+		&algo.EndAt,
+		&algo.CreatedAt,
+		&algo.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &algo, nil
+}
+
+// CreateAlgoOrder creates an algo order and its slices within a transaction
+func (r *AlgoRepository) CreateAlgoOrder(tx *sql.Tx, algo *models.AlgoOrder, slices []models.AlgoSlice) error {
+	query := `
+		INSERT INTO algo_orders (id, user_id, symbol, side, strategy, qty, limit_price, arrival_price,
+			status, start_at, end_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	_, err := tx.Exec(query,
+		algo.ID,
+		algo.UserID,
+		algo.Symbol,
+		algo.Side,
+		algo.Strategy,
+		algo.Qty,
+		algo.LimitPrice,
+		algo.ArrivalPrice,
+		algo.Status,
+		algo.StartAt,
+		algo.EndAt,
+		algo.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create algo order: %w", err)
+	}
+
+	sliceQuery := `
+		INSERT INTO algo_slices (algo_id, slice, due_at, target_qty)
+		VALUES ($1, $2, $3, $4)`
+
+	for _, slice := range slices {
+		if _, err := tx.Exec(sliceQuery, algo.ID, slice.Slice, slice.DueAt, slice.TargetQty); err != nil {
+			return fmt.Errorf("failed to create algo slice: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetAlgoOrder retrieves an algo order by ID
+func (r *AlgoRepository) GetAlgoOrder(id uuid.UUID) (*models.AlgoOrder, error) {
+	query := `
+		SELECT ` + algoColumns + `
+		FROM algo_orders
+		WHERE id = $1`
+
+	algo, err := scanAlgoOrder(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("algo order not found")
+		}
+		return nil, fmt.Errorf("failed to get algo order: %w", err)
+	}
+
+	return algo, nil
+}
+
+// GetAlgoOrdersByUserID retrieves a user's algo orders, newest first
+func (r *AlgoRepository) GetAlgoOrdersByUserID(userID uuid.UUID) ([]models.AlgoOrder, error) {
+	query := `
+		SELECT ` + algoColumns + `
+		FROM algo_orders
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	return r.queryAlgoOrders(query, userID)
+}
+
+// GetRunningAlgoOrders retrieves every algo order still working, oldest first
+func (r *AlgoRepository) GetRunningAlgoOrders() ([]models.AlgoOrder, error) {
+	query := `
+		SELECT ` + algoColumns + `
+		FROM algo_orders
+		WHERE status = 'RUNNING'
+		ORDER BY created_at ASC, id ASC`
+
+	return r.queryAlgoOrders(query)
+}
+
+// queryAlgoOrders runs a query selecting algoColumns
+func (r *AlgoRepository) queryAlgoOrders(query string, args ...interface{}) ([]models.AlgoOrder, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get algo orders: %w", err)
+	}
+	defer rows.Close()
+
+	algos := []models.AlgoOrder{}
+	for rows.Next() {
+		algo, err := scanAlgoOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algo order: %w", err)
+		}
+		algos = append(algos, *algo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get algo orders: %w", err)
+	}
+
+	return algos, nil
+}
+
+// GetSlices retrieves an algo order's schedule in slice order
+func (r *AlgoRepository) GetSlices(algoID uuid.UUID) ([]models.AlgoSlice, error) {
+	query := `
+		SELECT algo_id, slice, due_at, target_qty, order_id, submitted_at, error
+		FROM algo_slices
+		WHERE algo_id = $1
+		ORDER BY slice ASC`
+
+	rows, err := r.db.Query(query, algoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get algo slices: %w", err)
+	}
+	defer rows.Close()
+
+	slices := []models.AlgoSlice{}
+	for rows.Next() {
+		var slice models.AlgoSlice
+		err := rows.Scan(
+			&slice.AlgoID,
+			&slice.Slice,
+			&slice.DueAt,
+			&slice.TargetQty,
+			&slice.OrderID,
+			&slice.SubmittedAt,
+			&slice.Error,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan algo slice: %w", err)
+		}
+		slices = append(slices, slice)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get algo slices: %w", err)
+	}
+
+	return slices, nil
+}
+
+// SubmitSlices marks every unsubmitted slice up to and including slice as run at
+// submittedAt within a transaction. The child order or error is recorded on slice;
+// the earlier slices it caught up on are left without one.
+func (r *AlgoRepository) SubmitSlices(tx *sql.Tx, algoID uuid.UUID, slice int, orderID *uuid.UUID, errMsg *string, submittedAt time.Time) error {
+	query := `
+		UPDATE algo_slices
+		SET submitted_at = $3,
+			order_id = CASE WHEN slice = $2 THEN $4::uuid END,
+			error = CASE WHEN slice = $2 THEN $5::text END
+		WHERE algo_id = $1 AND slice <= $2 AND submitted_at IS NULL`
+
+	var child interface{}
+	if orderID != nil {
+		child = *orderID
+	}
+
+	if _, err := tx.Exec(query, algoID, slice, submittedAt, child, errMsg); err != nil {
+		return fmt.Errorf("failed to submit algo slices: %w", err)
+	}
+
+	return nil
+}
+
+// GetFillSummary returns the quantity an algo order's children have filled and
+// what it cost in the quote currency
+func (r *AlgoRepository) GetFillSummary(algoID uuid.UUID) (decimal.Decimal, decimal.Decimal, error) {
+	query := `
+		SELECT COALESCE(SUM(t.qty), 0), COALESCE(SUM(t.price * t.qty), 0)
+		FROM algo_slices s
+		JOIN trades t ON t.taker_order_id = s.order_id
+		WHERE s.algo_id = $1`
+
+	var qty, value decimal.Decimal
+	if err := r.db.QueryRow(query, algoID).Scan(&qty, &value); err != nil {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("failed to get algo fills: %w", err)
+	}
+
+	return qty, value, nil
+}
+
+// FinishAlgoOrder moves a running algo order to a final status. It reports false
+// when the order had already finished.
+func (r *AlgoRepository) FinishAlgoOrder(id uuid.UUID, status models.AlgoStatus, completedAt time.Time) (bool, error) {
+	query := `
+		UPDATE algo_orders
+		SET status = $2, completed_at = $3
+		WHERE id = $1 AND status = 'RUNNING'`
+
+	result, err := r.db.Exec(query, id, status, completedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to finish algo order: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to finish algo order: %w", err)
+	}
+
+	return rows > 0, nil
+}
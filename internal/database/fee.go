@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"microcoin/internal/models"
+)
+
+// FeeRepository handles fee schedule database operations
+type FeeRepository struct {
+	db *sql.DB
+}
+
+// NewFeeRepository creates a new fee repository
+func NewFeeRepository(db *sql.DB) *FeeRepository {
+	return &FeeRepository{db: db}
+}
+
+// GetFeeTiers retrieves the fee schedule, lowest volume tier first
+func (r *FeeRepository) GetFeeTiers() ([]models.FeeTier, error) {
+	query := `
+		SELECT min_volume, maker_bps, taker_bps
+		FROM fee_tiers
+		ORDER BY min_volume ASC`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fee tiers: %w", err)
+	}
+	defer rows.Close()
+
+	var tiers []models.FeeTier
+	for rows.Next() {
+		var tier models.FeeTier
+		if err := rows.Scan(&tier.MinVolume, &tier.MakerBps, &tier.TakerBps); err != nil {
+			return nil, fmt.Errorf("failed to scan fee tier: %w", err)
+		}
+		tiers = append(tiers, tier)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fee tiers: %w", err)
+	}
+
+	return tiers, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"microcoin/internal/models"
+)
+
+// InstrumentRepository handles instrument database operations
+type InstrumentRepository struct {
+	db *sql.DB
+}
+
+// NewInstrumentRepository creates a new instrument repository
+func NewInstrumentRepository(db *sql.DB) *InstrumentRepository {
+	return &InstrumentRepository{db: db}
+}
+
+// GetInstruments retrieves every listed instrument ordered by symbol
+func (r *InstrumentRepository) GetInstruments() ([]models.Instrument, error) {
+	query := `
+		SELECT symbol, base_currency, quote_currency, tick_size, lot_size, min_notional, status, created_at
+		FROM instruments
+		ORDER BY symbol ASC`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instruments: %w", err)
+	}
+	defer rows.Close()
+
+	var instruments []models.Instrument
+	for rows.Next() {
+		var instrument models.Instrument
+		err := rows.Scan(
+			&instrument.Symbol,
+			&instrument.BaseCurrency,
+			&instrument.QuoteCurrency,
+			&instrument.TickSize,
+			&instrument.LotSize,
+			&instrument.MinNotional,
+			&instrument.Status,
+			&instrument.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan instrument: %w", err)
+		}
+		instruments = append(instruments, instrument)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating instruments: %w", err)
+	}
+
+	return instruments, nil
+}
@@ -3,10 +3,13 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"microcoin/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 // OrderRepository handles order database operations
@@ -19,13 +22,56 @@ func NewOrderRepository(db *sql.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
-// CreateOrder creates a new order
-func (r *OrderRepository) CreateOrder(order *models.Order) error {
+// orderColumns lists the order columns in the order scanOrder reads them
+const orderColumns = `id, user_id, symbol, side, type, price, qty, filled_qty, status, created_at,
+		time_in_force, expires_at, post_only, reduce_only, stop_price, triggered_at,
+		trail_offset, trail_percent, display_qty`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder scans a row selected with orderColumns
+func scanOrder(row rowScanner) (*models.Order, error) {
+	var order models.Order
+	err := row.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Symbol,
+		&order.Side,
+		&order.Type,
+		&order.Price,
+		&order.Qty,
+		&order.FilledQty,
+		&order.Status,
+		&order.CreatedAt,
+		&order.TimeInForce,
+		&order.ExpiresAt,
+		&order.PostOnly,
+		&order.ReduceOnly,
+		&order.StopPrice,
+		&order.TriggeredAt,
+		&order.TrailOffset,
+		&order.TrailPercent,
+		&order.DisplayQty,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// CreateOrder creates a new order within a transaction
+func (r *OrderRepository) CreateOrder(tx *sql.Tx, order *models.Order) error {
 	query := `
-		INSERT INTO orders (id, user_id, symbol, side, type, price, qty, filled_qty, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+		INSERT INTO orders (id, user_id, symbol, side, type, price, qty, filled_qty, status, created_at, queued_at,
+			time_in_force, expires_at, post_only, reduce_only, stop_price, trail_offset, trail_percent,
+			display_qty)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $11, $12, $13, $14, $15, $16, $17, $18)`
 
-	_, err := r.db.Exec(query,
+	_, err := tx.Exec(query,
 		order.ID,
 		order.UserID,
 		order.Symbol,
@@ -36,6 +82,14 @@ func (r *OrderRepository) CreateOrder(order *models.Order) error {
 		order.FilledQty,
 		order.Status,
 		order.CreatedAt,
+		order.TimeInForce,
+		order.ExpiresAt,
+		order.PostOnly,
+		order.ReduceOnly,
+		order.StopPrice,
+		order.TrailOffset,
+		order.TrailPercent,
+		order.DisplayQty,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create order: %w", err)
@@ -47,23 +101,11 @@ func (r *OrderRepository) CreateOrder(order *models.Order) error {
 // GetOrderByID retrieves an order by ID
 func (r *OrderRepository) GetOrderByID(id uuid.UUID) (*models.Order, error) {
 	query := `
-		SELECT id, user_id, symbol, side, type, price, qty, filled_qty, status, created_at
+		SELECT ` + orderColumns + `
 		FROM orders
 		WHERE id = $1`
 
-	var order models.Order
-	err := r.db.QueryRow(query, id).Scan(
-		&order.ID,
-		&order.UserID,
-		&order.Symbol,
-		&order.Side,
-		&order.Type,
-		&order.Price,
-		&order.Qty,
-		&order.FilledQty,
-		&order.Status,
-		&order.CreatedAt,
-	)
+	order, err := scanOrder(r.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("order not found")
@@ -71,13 +113,13 @@ func (r *OrderRepository) GetOrderByID(id uuid.UUID) (*models.Order, error) {
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-	return &order, nil
+	return order, nil
 }
 
 // GetOrdersByUserID retrieves orders for a user
 func (r *OrderRepository) GetOrdersByUserID(userID uuid.UUID, limit, offset int) ([]models.Order, error) {
 	query := `
-		SELECT id, user_id, symbol, side, type, price, qty, filled_qty, status, created_at
+		SELECT ` + orderColumns + `
 		FROM orders
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -91,23 +133,11 @@ func (r *OrderRepository) GetOrdersByUserID(userID uuid.UUID, limit, offset int)
 
 	var orders []models.Order
 	for rows.Next() {
-		var order models.Order
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Symbol,
-			&order.Side,
-			&order.Type,
-			&order.Price,
-			&order.Qty,
-			&order.FilledQty,
-			&order.Status,
-			&order.CreatedAt,
-		)
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
-		orders = append(orders, order)
+		orders = append(orders, *order)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -132,13 +162,122 @@ func (r *OrderRepository) UpdateOrder(tx *sql.Tx, order *models.Order) error {
 	return nil
 }
 
+// AmendOrder updates an order's price, quantity and fill state within a transaction.
+// With requeue set the order moves to the back of the queue at its price.
+func (r *OrderRepository) AmendOrder(tx *sql.Tx, order *models.Order, requeue bool) error {
+	query := `
+		UPDATE orders
+		SET price = $1, qty = $2, filled_qty = $3, status = $4,
+			queued_at = CASE WHEN $5 THEN NOW() ELSE queued_at END
+		WHERE id = $6`
+
+	_, err := tx.Exec(query, order.Price, order.Qty, order.FilledQty, order.Status, requeue, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to amend order: %w", err)
+	}
+
+	return nil
+}
+
+// ActivateOrder moves a pending bracket child live with its final quantity within
+// a transaction. It joins the queue as of activation.
+func (r *OrderRepository) ActivateOrder(tx *sql.Tx, order *models.Order) error {
+	query := `
+		UPDATE orders
+		SET qty = $1, status = $2, queued_at = NOW()
+		WHERE id = $3 AND status = 'PENDING'`
+
+	result, err := tx.Exec(query, order.Qty, order.Status, order.ID)
+	if err != nil {
+		return fmt.Errorf("failed to activate order: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to activate order: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("failed to activate order: order %s is not pending", order.ID)
+	}
+
+	return nil
+}
+
+// TriggerOrder marks a stop order as triggered within a transaction. A triggered
+// stop rejoins the queue as of its trigger time.
+func (r *OrderRepository) TriggerOrder(tx *sql.Tx, orderID uuid.UUID, triggeredAt time.Time) error {
+	query := `
+		UPDATE orders
+		SET triggered_at = $1, queued_at = $1
+		WHERE id = $2 AND triggered_at IS NULL`
+
+	result, err := tx.Exec(query, triggeredAt, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to trigger order: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to trigger order: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("failed to trigger order: order %s already triggered", orderID)
+	}
+
+	return nil
+}
+
+// TrailStop moves an untriggered trailing stop's stop price within a transaction
+func (r *OrderRepository) TrailStop(tx *sql.Tx, orderID uuid.UUID, stopPrice decimal.Decimal) error {
+	query := `
+		UPDATE orders
+		SET stop_price = $1
+		WHERE id = $2 AND type = 'TRAILING_STOP' AND status = 'NEW' AND triggered_at IS NULL`
+
+	result, err := tx.Exec(query, stopPrice, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to trail stop: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to trail stop: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("failed to trail stop: order %s is not an open trailing stop", orderID)
+	}
+
+	return nil
+}
+
+// AddFill records a fill against a resting order within a transaction. An iceberg
+// whose fill completes a slice is requeued as of filledAt.
+func (r *OrderRepository) AddFill(tx *sql.Tx, orderID uuid.UUID, qty decimal.Decimal, filledAt time.Time) error {
+	query := `
+		UPDATE orders
+		SET filled_qty = filled_qty + $1,
+			status = CASE WHEN filled_qty + $1 >= qty THEN 'FILLED'::order_status ELSE 'PARTIALLY_FILLED'::order_status END,
+			queued_at = CASE
+				WHEN display_qty IS NOT NULL AND filled_qty + $1 < qty AND MOD(filled_qty + $1, display_qty) = 0 THEN $3
+				ELSE queued_at
+			END
+		WHERE id = $2`
+
+	_, err := tx.Exec(query, qty, orderID, filledAt)
+	if err != nil {
+		return fmt.Errorf("failed to add fill: %w", err)
+	}
+
+	return nil
+}
+
 // GetActiveOrdersBySymbol retrieves active orders for a symbol
 func (r *OrderRepository) GetActiveOrdersBySymbol(symbol models.Symbol) ([]models.Order, error) {
 	query := `
-		SELECT id, user_id, symbol, side, type, price, qty, filled_qty, status, created_at
+		SELECT ` + orderColumns + `
 		FROM orders
 		WHERE symbol = $1 AND status IN ('NEW', 'PARTIALLY_FILLED')
-		ORDER BY created_at ASC`
+		ORDER BY queued_at ASC, created_at ASC`
 
 	rows, err := r.db.Query(query, symbol)
 	if err != nil {
@@ -148,23 +287,138 @@ func (r *OrderRepository) GetActiveOrdersBySymbol(symbol models.Symbol) ([]model
 
 	var orders []models.Order
 	for rows.Next() {
-		var order models.Order
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Symbol,
-			&order.Side,
-			&order.Type,
-			&order.Price,
-			&order.Qty,
-			&order.FilledQty,
-			&order.Status,
-			&order.CreatedAt,
-		)
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// GetOpenQty returns the unfilled quantity of a user's open orders on one side of a
+// symbol, leaving out excludeID
+func (r *OrderRepository) GetOpenQty(userID uuid.UUID, symbol models.Symbol, side models.OrderSide, excludeID uuid.UUID) (decimal.Decimal, error) {
+	query := `
+		SELECT COALESCE(SUM(qty - filled_qty), 0)
+		FROM orders
+		WHERE user_id = $1 AND symbol = $2 AND side = $3 AND id <> $4
+			AND status IN ('NEW', 'PARTIALLY_FILLED')`
+
+	var openQty decimal.Decimal
+	if err := r.db.QueryRow(query, userID, symbol, side, excludeID).Scan(&openQty); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get open quantity: %w", err)
+	}
+
+	return openQty, nil
+}
+
+// GetExpiredOrders retrieves open good-till-date orders whose expiry has passed
+func (r *OrderRepository) GetExpiredOrders(now time.Time) ([]models.Order, error) {
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders
+		WHERE time_in_force = 'GTD' AND expires_at <= $1 AND status IN ('NEW', 'PARTIALLY_FILLED')
+		ORDER BY expires_at ASC`
+
+	rows, err := r.db.Query(query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// OrderFilter selects a page of a user's orders, newest first
+type OrderFilter struct {
+	Symbol      *models.Symbol
+	Side        *models.OrderSide
+	Status      *models.OrderStatus
+	Type        *models.OrderType
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// AfterCreatedAt and AfterID are the keyset position of the last order already seen
+	AfterCreatedAt *time.Time
+	AfterID        *uuid.UUID
+	Limit          int
+}
+
+// ListOrders retrieves a user's orders matching a filter using keyset pagination on (created_at, id)
+func (r *OrderRepository) ListOrders(userID uuid.UUID, filter *OrderFilter) ([]models.Order, error) {
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{userID}
+
+	addCondition := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if filter.Symbol != nil {
+		addCondition("symbol = $%d", *filter.Symbol)
+	}
+	if filter.Side != nil {
+		addCondition("side = $%d", *filter.Side)
+	}
+	if filter.Status != nil {
+		addCondition("status = $%d", *filter.Status)
+	}
+	if filter.Type != nil {
+		addCondition("type = $%d", *filter.Type)
+	}
+	if filter.CreatedFrom != nil {
+		addCondition("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		addCondition("created_at < $%d", *filter.CreatedTo)
+	}
+	if filter.AfterCreatedAt != nil && filter.AfterID != nil {
+		addCondition("(created_at, id) < ($%d, $%d)", *filter.AfterCreatedAt, *filter.AfterID)
+	}
+
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM orders
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d`, orderColumns, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
-		orders = append(orders, order)
+		orders = append(orders, *order)
 	}
 
 	if err := rows.Err(); err != nil {
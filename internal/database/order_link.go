@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// OrderLinkRepository handles bracket group database operations
+type OrderLinkRepository struct {
+	db *sql.DB
+}
+
+// NewOrderLinkRepository creates a new order link repository
+func NewOrderLinkRepository(db *sql.DB) *OrderLinkRepository {
+	return &OrderLinkRepository{db: db}
+}
+
+// CreateLink adds an order to a bracket group within a transaction
+func (r *OrderLinkRepository) CreateLink(tx *sql.Tx, link *models.OrderLink) error {
+	query := `
+		INSERT INTO order_links (order_id, group_id, role)
+		VALUES ($1, $2, $3)`
+
+	if _, err := tx.Exec(query, link.OrderID, link.GroupID, link.Role); err != nil {
+		return fmt.Errorf("failed to create order link: %w", err)
+	}
+
+	return nil
+}
+
+// GetGroup retrieves the links of a bracket group, parent first
+func (r *OrderLinkRepository) GetGroup(groupID uuid.UUID) ([]models.OrderLink, error) {
+	query := `
+		SELECT group_id, order_id, role
+		FROM order_links
+		WHERE group_id = $1
+		ORDER BY role ASC`
+
+	rows, err := r.db.Query(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order group: %w", err)
+	}
+	defer rows.Close()
+
+	var links []models.OrderLink
+	for rows.Next() {
+		var link models.OrderLink
+		if err := rows.Scan(&link.GroupID, &link.OrderID, &link.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan order link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order links: %w", err)
+	}
+
+	return links, nil
+}
+
+// GetLink retrieves the link of an order, or nil if it is not in a group
+func (r *OrderLinkRepository) GetLink(orderID uuid.UUID) (*models.OrderLink, error) {
+	query := `
+		SELECT group_id, order_id, role
+		FROM order_links
+		WHERE order_id = $1`
+
+	var link models.OrderLink
+	err := r.db.QueryRow(query, orderID).Scan(&link.GroupID, &link.OrderID, &link.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// GetGroupIDs returns the distinct groups that any of the orders belong to
+func (r *OrderLinkRepository) GetGroupIDs(orderIDs []uuid.UUID) ([]uuid.UUID, error) {
+	ids := make([]string, len(orderIDs))
+	for i, id := range orderIDs {
+		ids[i] = id.String()
+	}
+
+	query := `
+		SELECT DISTINCT group_id
+		FROM order_links
+		WHERE order_id = ANY($1::uuid[])`
+
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groupIDs []uuid.UUID
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err := rows.Scan(&groupID); err != nil {
+			return nil, fmt.Errorf("failed to scan order group: %w", err)
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order groups: %w", err)
+	}
+
+	return groupIDs, nil
+}
+
+// GetOpenGroupIDs returns the groups that still have a pending or open child
+func (r *OrderLinkRepository) GetOpenGroupIDs() ([]uuid.UUID, error) {
+	query := `
+		SELECT DISTINCT l.group_id
+		FROM order_links l
+		JOIN orders o ON o.id = l.order_id
+		WHERE l.role <> 'PARENT' AND o.status IN ('PENDING', 'NEW', 'PARTIALLY_FILLED')`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open order groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groupIDs []uuid.UUID
+	for rows.Next() {
+		var groupID uuid.UUID
+		if err := rows.Scan(&groupID); err != nil {
+			return nil, fmt.Errorf("failed to scan order group: %w", err)
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order groups: %w", err)
+	}
+
+	return groupIDs, nil
+}
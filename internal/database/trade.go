@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// TradeRepository handles trade database operations
+type TradeRepository struct {
+	db *sql.DB
+}
+
+// NewTradeRepository creates a new trade repository
+func NewTradeRepository(db *sql.DB) *TradeRepository {
+	return &TradeRepository{db: db}
+}
+
+// CreateTrade records a trade within a transaction
+func (r *TradeRepository) CreateTrade(tx *sql.Tx, trade *models.Trade) error {
+	query := `
+		INSERT INTO trades (id, symbol, side, price, qty, taker_order_id, maker_order_id,
+			taker_user_id, maker_user_id, taker_fee, maker_fee, fee_currency, maker_fee_currency, notional_usd, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+
+	_, err := tx.Exec(query,
+		trade.ID,
+		trade.Symbol,
+		trade.Side,
+		trade.Price,
+		trade.Qty,
+		trade.TakerOrderID,
+		nullableUUID(trade.MakerOrderID),
+		trade.TakerID,
+		nullableUUID(trade.MakerID),
+		trade.TakerFee,
+		trade.MakerFee,
+		trade.TakerFeeCurrency,
+		trade.MakerFeeCurrency,
+		trade.NotionalUSD,
+		trade.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create trade: %w", err)
+	}
+
+	return nil
+}
+
+// nullableUUID stores uuid.Nil as NULL; liquidity provider trades have no maker
+func nullableUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+// fillsQuery returns both sides of matching trades as fills; the maker's side is the
+// opposite of the taker side recorded on the trade
+const fillsQuery = `
+	SELECT id, order_id, symbol, side, price, qty, fee, fee_currency, liquidity, created_at
+	FROM (
+		SELECT id, taker_order_id AS order_id, taker_user_id AS user_id, symbol, side, price, qty,
+			taker_fee AS fee, fee_currency, 'TAKER' AS liquidity, created_at
+		FROM trades
+		UNION ALL
+		SELECT id, maker_order_id, maker_user_id, symbol,
+			CASE side WHEN 'BUY' THEN 'SELL'::order_side ELSE 'BUY'::order_side END,
+			price, qty, maker_fee, maker_fee_currency, 'MAKER', created_at
+		FROM trades
+	) fills`
+
+// GetNetPosition returns a user's net traded quantity in a symbol: bought minus sold,
+// less any fees paid in the base currency
+func (r *TradeRepository) GetNetPosition(userID uuid.UUID, symbol models.Symbol) (decimal.Decimal, error) {
+	query := `
+		SELECT COALESCE(SUM(
+			CASE side WHEN 'BUY' THEN qty ELSE -qty END
+			- CASE WHEN fee_currency::text = split_part(symbol, '-', 1) THEN fee ELSE 0 END
+		), 0)
+		FROM (` + fillsQuery + `
+			WHERE user_id = $1 AND symbol = $2
+		) net`
+
+	var position decimal.Decimal
+	if err := r.db.QueryRow(query, userID, symbol).Scan(&position); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get net position: %w", err)
+	}
+
+	return position, nil
+}
+
+// GetUserVolume returns the USD value a user has traded, as taker or maker, since a time
+func (r *TradeRepository) GetUserVolume(userID uuid.UUID, since time.Time) (decimal.Decimal, error) {
+	query := `
+		SELECT COALESCE(SUM(notional_usd), 0)
+		FROM trades
+		WHERE (taker_user_id = $1 OR maker_user_id = $1) AND created_at >= $2`
+
+	var volume decimal.Decimal
+	if err := r.db.QueryRow(query, userID, since).Scan(&volume); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get traded volume: %w", err)
+	}
+
+	return volume, nil
+}
+
+// GetVolumeProfile returns the quantity traded in a symbol over the lookback before
+// start, bucketed by time of day: bucket i collects the trades that fell between
+// start+i*interval and start+(i+1)*interval on any earlier day. The buckets must
+// fit within a day.
+func (r *TradeRepository) GetVolumeProfile(symbol models.Symbol, start time.Time, interval time.Duration, buckets int, lookback time.Duration) ([]decimal.Decimal, error) {
+	query := `
+		SELECT bucket, SUM(qty)
+		FROM (
+			SELECT qty,
+				FLOOR(MOD(MOD(EXTRACT(EPOCH FROM created_at - $2::timestamptz), 86400) + 86400, 86400) / $3)::int AS bucket
+			FROM trades
+			WHERE symbol = $1 AND created_at >= $4 AND created_at < $2
+		) bucketed
+		WHERE bucket < $5
+		GROUP BY bucket`
+
+	rows, err := r.db.Query(query, symbol, start, interval.Seconds(), start.Add(-lookback), buckets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume profile: %w", err)
+	}
+	defer rows.Close()
+
+	profile := make([]decimal.Decimal, buckets)
+	for i := range profile {
+		profile[i] = decimal.Zero
+	}
+
+	for rows.Next() {
+		var bucket int
+		var qty decimal.Decimal
+		if err := rows.Scan(&bucket, &qty); err != nil {
+			return nil, fmt.Errorf("failed to scan volume profile: %w", err)
+		}
+		profile[bucket] = qty
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get volume profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// GetFillsByUserID retrieves a user's most recent fills
+func (r *TradeRepository) GetFillsByUserID(userID uuid.UUID, limit int) ([]models.Fill, error) {
+	query := fillsQuery + `
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := r.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fills: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFills(rows)
+}
+
+// GetFillHistoryByUserID retrieves all of a user's fills in execution order
+func (r *TradeRepository) GetFillHistoryByUserID(userID uuid.UUID) ([]models.Fill, error) {
+	query := fillsQuery + `
+		WHERE user_id = $1
+		ORDER BY created_at ASC, id ASC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fill history: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFills(rows)
+}
+
+// GetFillsByOrderID retrieves the fills of an order in execution order
+func (r *TradeRepository) GetFillsByOrderID(orderID uuid.UUID) ([]models.Fill, error) {
+	query := fillsQuery + `
+		WHERE order_id = $1
+		ORDER BY created_at ASC, id ASC`
+
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fills: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFills(rows)
+}
+
+// scanFills scans fill rows
+func scanFills(rows *sql.Rows) ([]models.Fill, error) {
+	fills := []models.Fill{}
+	for rows.Next() {
+		var fill models.Fill
+		err := rows.Scan(
+			&fill.TradeID,
+			&fill.OrderID,
+			&fill.Symbol,
+			&fill.Side,
+			&fill.Price,
+			&fill.Qty,
+			&fill.Fee,
+			&fill.FeeCurrency,
+			&fill.Liquidity,
+			&fill.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan fill: %w", err)
+		}
+		fills = append(fills, fill)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fills: %w", err)
+	}
+
+	return fills, nil
+}
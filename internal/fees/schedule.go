@@ -0,0 +1,86 @@
+package fees
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"microcoin/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// VolumeWindow is the trailing period whose traded volume picks a user's tier
+const VolumeWindow = 30 * 24 * time.Hour
+
+// feePrecision is the number of decimal places fees are rounded to, matching the
+// NUMERIC(30,10) ledger columns
+const feePrecision = 10
+
+var bpsPerUnit = decimal.NewFromInt(10000)
+
+// Schedule maps a user's 30-day traded volume to maker and taker fees
+type Schedule struct {
+	tiers []models.FeeTier
+}
+
+// NewSchedule creates a schedule from its tiers. The tiers must start at zero
+// volume and carry no negative fees.
+func NewSchedule(tiers []models.FeeTier) (*Schedule, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("fee schedule has no tiers")
+	}
+
+	sorted := make([]models.FeeTier, len(tiers))
+	copy(sorted, tiers)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinVolume.LessThan(sorted[j].MinVolume)
+	})
+
+	if !sorted[0].MinVolume.IsZero() {
+		return nil, fmt.Errorf("fee schedule must start at zero volume")
+	}
+	for i, tier := range sorted {
+		if tier.MakerBps.IsNegative() || tier.TakerBps.IsNegative() {
+			return nil, fmt.Errorf("fee tier at %s has a negative fee", tier.MinVolume)
+		}
+		if i > 0 && tier.MinVolume.Equal(sorted[i-1].MinVolume) {
+			return nil, fmt.Errorf("duplicate fee tier at %s", tier.MinVolume)
+		}
+	}
+
+	return &Schedule{tiers: sorted}, nil
+}
+
+// DefaultSchedule returns the schedule seeded by the fee_tiers migration
+func DefaultSchedule() *Schedule {
+	return &Schedule{tiers: []models.FeeTier{
+		{MinVolume: decimal.Zero, MakerBps: decimal.NewFromInt(10), TakerBps: decimal.NewFromInt(20)},
+		{MinVolume: decimal.NewFromInt(100000), MakerBps: decimal.NewFromInt(8), TakerBps: decimal.NewFromInt(16)},
+		{MinVolume: decimal.NewFromInt(1000000), MakerBps: decimal.NewFromInt(5), TakerBps: decimal.NewFromInt(10)},
+	}}
+}
+
+// Tiers returns the schedule's tiers, lowest volume first
+func (s *Schedule) Tiers() []models.FeeTier {
+	tiers := make([]models.FeeTier, len(s.tiers))
+	copy(tiers, s.tiers)
+	return tiers
+}
+
+// TierFor returns the highest tier a 30-day volume has reached
+func (s *Schedule) TierFor(volume decimal.Decimal) models.FeeTier {
+	tier := s.tiers[0]
+	for _, candidate := range s.tiers[1:] {
+		if volume.LessThan(candidate.MinVolume) {
+			break
+		}
+		tier = candidate
+	}
+	return tier
+}
+
+// Fee returns bps basis points of amount
+func Fee(amount, bps decimal.Decimal) decimal.Decimal {
+	return amount.Mul(bps).Div(bpsPerUnit).Round(feePrecision)
+}
@@ -2,19 +2,45 @@ package idempotency
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
+	"microcoin/internal/auth"
 	"microcoin/internal/models"
 
 	"github.com/google/uuid"
 )
 
+const (
+	// DefaultTTL is how long a completed response is replayed for
+	DefaultTTL = 24 * time.Hour
+	// InProgressTimeout is how long a claim may stay in progress before it is
+	// considered abandoned (e.g. the process died) and can be claimed again
+	InProgressTimeout = time.Minute
+)
+
+var (
+	// ErrKeyMismatch is returned when a key is reused for a different request
+	ErrKeyMismatch = errors.New("idempotency key mismatch")
+	// ErrRequestInProgress is returned when the same request is already executing
+	ErrRequestInProgress = errors.New("request with this idempotency key is in progress")
+	// ErrClaimLost is returned when completing a claim that has since been taken over
+	ErrClaimLost = errors.New("idempotency key claim lost")
+)
+
+type contextKey string
+
+const txKey contextKey = "idempotency_tx"
+
 // Repository handles idempotency database operations
 type Repository struct {
 	db *sql.DB
@@ -28,7 +54,7 @@ func NewRepository(db *sql.DB) *Repository {
 // GetIdempotencyKey retrieves an idempotency key
 func (r *Repository) GetIdempotencyKey(userID uuid.UUID, key string) (*models.IdempotencyKey, error) {
 	query := `
-		SELECT id, user_id, idem_key, request_fingerprint, response_code, response_body, created_at
+		SELECT id, user_id, idem_key, request_fingerprint, status, response_code, response_body, created_at, expires_at
 		FROM idempotency_keys
 		WHERE user_id = $1 AND idem_key = $2`
 
@@ -38,9 +64,11 @@ func (r *Repository) GetIdempotencyKey(userID uuid.UUID, key string) (*models.Id
 		&idemKey.UserID,
 		&idemKey.IdemKey,
 		&idemKey.RequestFingerprint,
+		&idemKey.Status,
 		&idemKey.ResponseCode,
 		&idemKey.ResponseBody,
 		&idemKey.CreatedAt,
+		&idemKey.ExpiresAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -55,15 +83,17 @@ func (r *Repository) GetIdempotencyKey(userID uuid.UUID, key string) (*models.Id
 // CreateIdempotencyKey creates a new idempotency key
 func (r *Repository) CreateIdempotencyKey(tx *sql.Tx, idemKey *models.IdempotencyKey) error {
 	query := `
-		INSERT INTO idempotency_keys (user_id, idem_key, request_fingerprint, response_code, response_body)
-		VALUES ($1, $2, $3, $4, $5)`
+		INSERT INTO idempotency_keys (user_id, idem_key, request_fingerprint, status, response_code, response_body, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	_, err := tx.Exec(query,
 		idemKey.UserID,
 		idemKey.IdemKey,
 		idemKey.RequestFingerprint,
+		idemKey.Status,
 		idemKey.ResponseCode,
 		idemKey.ResponseBody,
+		idemKey.ExpiresAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create idempotency key: %w", err)
@@ -72,15 +102,110 @@ func (r *Repository) CreateIdempotencyKey(tx *sql.Tx, idemKey *models.Idempotenc
 	return nil
 }
 
+// ClaimIdempotencyKey inserts an in-progress key, reporting false if the key already exists
+func (r *Repository) ClaimIdempotencyKey(idemKey *models.IdempotencyKey) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, idem_key, request_fingerprint, status, response_code, response_body, expires_at)
+		VALUES ($1, $2, $3, $4, 0, '{}', $5)
+		ON CONFLICT (user_id, idem_key) DO NOTHING
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(query,
+		idemKey.UserID,
+		idemKey.IdemKey,
+		idemKey.RequestFingerprint,
+		models.IdempotencyStatusInProgress,
+		idemKey.ExpiresAt,
+	).Scan(&idemKey.ID, &idemKey.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	idemKey.Status = models.IdempotencyStatusInProgress
+	return true, nil
+}
+
+// CompleteIdempotencyKey stores the response of an in-progress key within a transaction
+func (r *Repository) CompleteIdempotencyKey(tx *sql.Tx, id uuid.UUID, responseCode int, responseBody []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = $1, response_code = $2, response_body = $3
+		WHERE id = $4 AND status = $5`
+
+	result, err := tx.Exec(query, models.IdempotencyStatusCompleted, responseCode, responseBody, id, models.IdempotencyStatusInProgress)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if rows != 1 {
+		return ErrClaimLost
+	}
+
+	return nil
+}
+
+// DeleteInProgressKey removes an in-progress key so the request can be retried
+func (r *Repository) DeleteInProgressKey(id uuid.UUID) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE id = $1 AND status = $2`
+
+	_, err := r.db.Exec(query, id, models.IdempotencyStatusInProgress)
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteStaleKey removes a key that has expired or whose claim was abandoned
+func (r *Repository) DeleteStaleKey(id uuid.UUID, abandonedBefore time.Time) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE id = $1 AND (expires_at < NOW() OR (status = $2 AND created_at < $3))`
+
+	_, err := r.db.Exec(query, id, models.IdempotencyStatusInProgress, abandonedBefore)
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredKeys removes every expired key
+func (r *Repository) DeleteExpiredKeys() (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at < NOW()`
+
+	result, err := r.db.Exec(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
 // Service handles idempotency business logic
 type Service struct {
+	db   *sql.DB
 	repo *Repository
+	ttl  time.Duration
 }
 
 // NewService creates a new idempotency service
 func NewService(db *sql.DB) *Service {
 	return &Service{
+		db:   db,
 		repo: NewRepository(db),
+		ttl:  DefaultTTL,
 	}
 }
 
@@ -106,13 +231,13 @@ func (s *Service) CheckIdempotency(userID uuid.UUID, key string, fingerprint str
 		return nil, err
 	}
 
-	if idemKey == nil {
+	if idemKey == nil || time.Now().After(idemKey.ExpiresAt) {
 		return nil, nil // New request
 	}
 
 	// Check if fingerprint matches
 	if idemKey.RequestFingerprint != fingerprint {
-		return nil, fmt.Errorf("idempotency key mismatch")
+		return nil, ErrKeyMismatch
 	}
 
 	return idemKey, nil
@@ -124,18 +249,140 @@ func (s *Service) StoreIdempotency(tx *sql.Tx, userID uuid.UUID, key, fingerprin
 		UserID:             userID,
 		IdemKey:            key,
 		RequestFingerprint: fingerprint,
+		Status:             models.IdempotencyStatusCompleted,
 		ResponseCode:       responseCode,
 		ResponseBody:       responseBody,
+		ExpiresAt:          time.Now().Add(s.ttl),
 	}
 
 	return s.repo.CreateIdempotencyKey(tx, idemKey)
 }
 
-// IdempotentHandler wraps an HTTP handler with idempotency
+// Begin claims an idempotency key before the business operation runs.
+// If the returned key is COMPLETED the caller replays its stored response;
+// otherwise the caller owns the key and must Complete or Release it.
+func (s *Service) Begin(userID uuid.UUID, key, fingerprint string) (*models.IdempotencyKey, error) {
+	// A stale key is deleted and claimed again, so allow one retry
+	for attempt := 0; attempt < 2; attempt++ {
+		claim := &models.IdempotencyKey{
+			UserID:             userID,
+			IdemKey:            key,
+			RequestFingerprint: fingerprint,
+			ExpiresAt:          time.Now().Add(s.ttl),
+		}
+
+		claimed, err := s.repo.ClaimIdempotencyKey(claim)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return claim, nil
+		}
+
+		existing, err := s.repo.GetIdempotencyKey(userID, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			continue // Released in the meantime
+		}
+
+		abandonedBefore := time.Now().Add(-InProgressTimeout)
+		expired := time.Now().After(existing.ExpiresAt)
+		abandoned := existing.Status == models.IdempotencyStatusInProgress && existing.CreatedAt.Before(abandonedBefore)
+		if expired || abandoned {
+			if err := s.repo.DeleteStaleKey(existing.ID, abandonedBefore); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if existing.RequestFingerprint != fingerprint {
+			return nil, ErrKeyMismatch
+		}
+
+		if existing.Status == models.IdempotencyStatusInProgress {
+			return nil, ErrRequestInProgress
+		}
+
+		return existing, nil
+	}
+
+	return nil, ErrRequestInProgress
+}
+
+// Complete stores the response for a claimed key in the business operation's transaction
+func (s *Service) Complete(tx *sql.Tx, claim *models.IdempotencyKey, responseCode int, responseBody []byte) error {
+	return s.repo.CompleteIdempotencyKey(tx, claim.ID, responseCode, responseBody)
+}
+
+// Release gives up a claimed key after a failed operation so the request can be retried
+func (s *Service) Release(claim *models.IdempotencyKey) error {
+	return s.repo.DeleteInProgressKey(claim.ID)
+}
+
+// PurgeExpired deletes keys whose TTL has passed
+func (s *Service) PurgeExpired() (int64, error) {
+	return s.repo.DeleteExpiredKeys()
+}
+
+// StartExpirer periodically purges expired keys until the context is canceled
+func (s *Service) StartExpirer(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := s.PurgeExpired()
+				if err != nil {
+					log.Printf("Failed to purge expired idempotency keys: %v", err)
+					continue
+				}
+				if purged > 0 {
+					log.Printf("Purged %d expired idempotency keys", purged)
+				}
+			}
+		}
+	}()
+}
+
+// TxFromContext returns the transaction IdempotentHandler opened for the request.
+// Handlers that write their business effect through it commit atomically with the key.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey).(*sql.Tx)
+	return tx, ok
+}
+
+// WriteError writes the HTTP error for a failed Begin
+func WriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrKeyMismatch):
+		http.Error(w, "Idempotency key mismatch", http.StatusConflict)
+	case errors.Is(err, ErrRequestInProgress):
+		http.Error(w, "Request with this Idempotency-Key is in progress", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to check idempotency key", http.StatusInternalServerError)
+	}
+}
+
+// Replay writes a stored response
+func Replay(w http.ResponseWriter, idemKey *models.IdempotencyKey) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(idemKey.ResponseCode)
+	w.Write(idemKey.ResponseBody)
+}
+
+// IdempotentHandler wraps an HTTP handler with idempotency. The handler runs with
+// a transaction in its context (see TxFromContext); a successful response is stored
+// and committed in that transaction, anything else is rolled back and the key released.
 func IdempotentHandler(handler http.HandlerFunc, service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract user ID from context (set by auth middleware)
-		userID, ok := r.Context().Value("user_id").(uuid.UUID)
+		userID, ok := auth.GetUserIDFromContext(r.Context())
 		if !ok {
 			http.Error(w, "User not authenticated", http.StatusUnauthorized)
 			return
@@ -167,32 +414,52 @@ func IdempotentHandler(handler http.HandlerFunc, service *Service) http.HandlerF
 		}
 		fingerprint := service.GenerateFingerprint(body, headers)
 
-		// Check idempotency
-		existingKey, err := service.CheckIdempotency(userID, idemKey, fingerprint)
+		// Claim the key, or replay the stored response
+		claim, err := service.Begin(userID, idemKey, fingerprint)
 		if err != nil {
-			http.Error(w, "Idempotency key mismatch", http.StatusConflict)
+			WriteError(w, err)
+			return
+		}
+		if claim.Status == models.IdempotencyStatusCompleted {
+			Replay(w, claim)
 			return
 		}
 
-		// If we have a cached response, return it
-		if existingKey != nil {
-			w.WriteHeader(existingKey.ResponseCode)
-			w.Write(existingKey.ResponseBody)
+		tx, err := service.db.Begin()
+		if err != nil {
+			service.Release(claim)
+			http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
 
 		// Execute the handler and capture response
 		recorder := httptest.NewRecorder()
-		handler(recorder, r)
+		handler(recorder, r.WithContext(context.WithValue(r.Context(), txKey, tx)))
 
-		// Store the response for future idempotent requests
-		// Note: In a real implementation, you'd want to store this in a transaction
-		// along with the business operation to ensure atomicity
 		responseBody := recorder.Body.Bytes()
 		responseCode := recorder.Code
 
-		// For now, we'll just return the response
-		// In a real implementation, you'd store this in the database
+		// Only successful responses are kept; failures roll back and may be retried
+		if responseCode >= 200 && responseCode < 300 {
+			err = service.Complete(tx, claim, responseCode, responseBody)
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				tx.Rollback()
+				service.Release(claim)
+				http.Error(w, "Failed to store idempotency key", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			tx.Rollback()
+			service.Release(claim)
+		}
+
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
 		w.WriteHeader(responseCode)
 		w.Write(responseBody)
 	}
@@ -0,0 +1,72 @@
+package instruments
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"microcoin/internal/database"
+	"microcoin/internal/models"
+)
+
+// ErrUnknownSymbol is returned when a symbol is not a listed instrument
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// Registry holds the listed instruments, loaded once at startup
+type Registry struct {
+	instruments map[models.Symbol]*models.Instrument
+	symbols     []models.Symbol
+}
+
+// NewRegistry creates a registry from a list of instruments
+func NewRegistry(list []models.Instrument) *Registry {
+	registry := &Registry{
+		instruments: make(map[models.Symbol]*models.Instrument, len(list)),
+	}
+
+	for i := range list {
+		instrument := list[i]
+		if _, exists := registry.instruments[instrument.Symbol]; exists {
+			continue
+		}
+		registry.instruments[instrument.Symbol] = &instrument
+		registry.symbols = append(registry.symbols, instrument.Symbol)
+	}
+
+	return registry
+}
+
+// Load reads the instruments table into a registry
+func Load(db *sql.DB) (*Registry, error) {
+	list, err := database.NewInstrumentRepository(db).GetInstruments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load instruments: %w", err)
+	}
+
+	return NewRegistry(list), nil
+}
+
+// Get returns the instrument listed under a symbol
+func (r *Registry) Get(symbol models.Symbol) (*models.Instrument, error) {
+	instrument, exists := r.instruments[symbol]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+	}
+	return instrument, nil
+}
+
+// Symbols returns every listed symbol in load order
+func (r *Registry) Symbols() []models.Symbol {
+	symbols := make([]models.Symbol, len(r.symbols))
+	copy(symbols, r.symbols)
+	return symbols
+}
+
+// List returns every listed instrument in load order
+func (r *Registry) List() []models.Instrument {
+	list := make([]models.Instrument, 0, len(r.symbols))
+	for _, symbol := range r.symbols {
+		list = append(list, *r.instruments[symbol])
+	}
+	return list
+}
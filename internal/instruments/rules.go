@@ -0,0 +1,44 @@
+package instruments
+
+import (
+	"errors"
+	"fmt"
+
+	"microcoin/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrInvalidTickSize is returned when a price is not a multiple of the tick size
+	ErrInvalidTickSize = errors.New("price is not a multiple of the tick size")
+	// ErrInvalidLotSize is returned when a quantity is not a multiple of the lot size
+	ErrInvalidLotSize = errors.New("quantity is not a multiple of the lot size")
+	// ErrBelowMinNotional is returned when an order's value is below the minimum notional
+	ErrBelowMinNotional = errors.New("order value is below the minimum notional")
+)
+
+// CheckPrice verifies that a price is a whole number of ticks
+func CheckPrice(instrument *models.Instrument, price decimal.Decimal) error {
+	if !price.Mod(instrument.TickSize).IsZero() {
+		return fmt.Errorf("%w: %s is not a multiple of %s on %s", ErrInvalidTickSize, price, instrument.TickSize, instrument.Symbol)
+	}
+	return nil
+}
+
+// CheckQty verifies that a quantity is a whole number of lots
+func CheckQty(instrument *models.Instrument, qty decimal.Decimal) error {
+	if !qty.Mod(instrument.LotSize).IsZero() {
+		return fmt.Errorf("%w: %s is not a multiple of %s on %s", ErrInvalidLotSize, qty, instrument.LotSize, instrument.Symbol)
+	}
+	return nil
+}
+
+// CheckNotional verifies that an order's value in the quote currency meets the
+// instrument's minimum
+func CheckNotional(instrument *models.Instrument, price, qty decimal.Decimal) error {
+	if notional := price.Mul(qty); notional.LessThan(instrument.MinNotional) {
+		return fmt.Errorf("%w: %s is below %s %s on %s", ErrBelowMinNotional, notional, instrument.MinNotional, instrument.QuoteCurrency, instrument.Symbol)
+	}
+	return nil
+}
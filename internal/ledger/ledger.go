@@ -26,14 +26,16 @@ func (r *LedgerRepository) CreateJournal(tx *sql.Tx, entries []models.LedgerEntr
 		return fmt.Errorf("journal must have at least one entry")
 	}
 
-	// Validate that the journal is balanced (sum of amounts = 0)
-	var total decimal.Decimal
+	// Validate that the journal is balanced (sum of amounts = 0) in every currency
+	totals := make(map[models.Currency]decimal.Decimal)
 	for _, entry := range entries {
-		total = total.Add(entry.Amount)
+		totals[entry.Currency] = totals[entry.Currency].Add(entry.Amount)
 	}
 
-	if !total.IsZero() {
-		return fmt.Errorf("journal is not balanced: total = %s", total.String())
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("journal is not balanced: %s total = %s", currency, total.String())
+		}
 	}
 
 	// Insert all entries
@@ -140,18 +142,126 @@ func (r *LedgerRepository) GetLedgerEntriesByAccountID(accountID uuid.UUID, limi
 	return entries, nil
 }
 
-// ValidateJournalBalance validates that a journal is balanced
+// ValidateJournalBalance validates that a journal is balanced in every currency
 func (r *LedgerRepository) ValidateJournalBalance(journalID uuid.UUID) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (
+			SELECT 1
+			FROM ledger_entries
+			WHERE journal_id = $1
+			GROUP BY currency
+			HAVING SUM(amount) <> 0
+		)`
+
+	var balanced bool
+	err := r.db.QueryRow(query, journalID).Scan(&balanced)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate journal balance: %w", err)
+	}
+
+	return balanced, nil
+}
+
+// GetJournalIDs retrieves the IDs of every journal in the ledger
+func (r *LedgerRepository) GetJournalIDs() ([]uuid.UUID, error) {
+	query := `
+		SELECT DISTINCT journal_id
+		FROM ledger_entries`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var journalIDs []uuid.UUID
+	for rows.Next() {
+		var journalID uuid.UUID
+		if err := rows.Scan(&journalID); err != nil {
+			return nil, fmt.Errorf("failed to scan journal ID: %w", err)
+		}
+		journalIDs = append(journalIDs, journalID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating journal IDs: %w", err)
+	}
+
+	return journalIDs, nil
+}
+
+// GetAccountTotals sums the ledger entries of every account
+func (r *LedgerRepository) GetAccountTotals() (map[uuid.UUID]decimal.Decimal, error) {
+	query := `
+		SELECT account_id, SUM(amount)
+		FROM ledger_entries
+		GROUP BY account_id`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make(map[uuid.UUID]decimal.Decimal)
+	for rows.Next() {
+		var accountID uuid.UUID
+		var total decimal.Decimal
+		if err := rows.Scan(&accountID, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan account total: %w", err)
+		}
+		totals[accountID] = total
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating account totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+// GetAccountTotalTx sums the ledger entries of one account within a transaction
+func (r *LedgerRepository) GetAccountTotalTx(tx *sql.Tx, accountID uuid.UUID) (decimal.Decimal, error) {
 	query := `
 		SELECT COALESCE(SUM(amount), 0)
 		FROM ledger_entries
-		WHERE journal_id = $1`
+		WHERE account_id = $1`
 
 	var total decimal.Decimal
-	err := r.db.QueryRow(query, journalID).Scan(&total)
+	err := tx.QueryRow(query, accountID).Scan(&total)
 	if err != nil {
-		return false, fmt.Errorf("failed to validate journal balance: %w", err)
+		return decimal.Zero, fmt.Errorf("failed to get account total: %w", err)
+	}
+
+	return total, nil
+}
+
+// GetTrialBalance sums every ledger entry per currency
+func (r *LedgerRepository) GetTrialBalance() (map[models.Currency]decimal.Decimal, error) {
+	query := `
+		SELECT currency, COALESCE(SUM(amount), 0)
+		FROM ledger_entries
+		GROUP BY currency`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trial balance: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make(map[models.Currency]decimal.Decimal)
+	for rows.Next() {
+		var currency models.Currency
+		var total decimal.Decimal
+		if err := rows.Scan(&currency, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan trial balance: %w", err)
+		}
+		totals[currency] = total
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trial balance: %w", err)
 	}
 
-	return total.IsZero(), nil
+	return totals, nil
 }
@@ -0,0 +1,163 @@
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AccountDiscrepancy describes an account whose stored balance differs from its ledger
+type AccountDiscrepancy struct {
+	AccountID     uuid.UUID       `json:"account_id"`
+	UserID        *uuid.UUID      `json:"user_id,omitempty"`
+	Currency      models.Currency `json:"currency"`
+	StoredBalance decimal.Decimal `json:"stored_balance"`
+	LedgerBalance decimal.Decimal `json:"ledger_balance"`
+	Difference    decimal.Decimal `json:"difference"`
+	Repaired      bool            `json:"repaired"`
+}
+
+// ReconciliationReport is the outcome of replaying the ledger against stored balances
+type ReconciliationReport struct {
+	AccountsChecked    int                                 `json:"accounts_checked"`
+	JournalsChecked    int                                 `json:"journals_checked"`
+	Discrepancies      []AccountDiscrepancy                `json:"discrepancies"`
+	UnbalancedJournals []uuid.UUID                         `json:"unbalanced_journals"`
+	TrialBalance       map[models.Currency]decimal.Decimal `json:"trial_balance"`
+	CheckedAt          time.Time                           `json:"checked_at"`
+}
+
+// OK reports whether the ledger and stored balances agree
+func (r *ReconciliationReport) OK() bool {
+	for _, total := range r.TrialBalance {
+		if !total.IsZero() {
+			return false
+		}
+	}
+
+	for _, discrepancy := range r.Discrepancies {
+		if !discrepancy.Repaired {
+			return false
+		}
+	}
+
+	return len(r.UnbalancedJournals) == 0
+}
+
+// Reconcile replays all journals per account and compares them with the stored balances.
+// Holds are not journaled, so an account's ledger total is compared with available + hold.
+// With repair set, mismatched accounts have their available balance rebuilt from the ledger.
+func (s *Service) Reconcile(repair bool) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{
+		Discrepancies:      []AccountDiscrepancy{},
+		UnbalancedJournals: []uuid.UUID{},
+		CheckedAt:          time.Now(),
+	}
+
+	// Every journal must net to zero in each currency
+	journalIDs, err := s.ledgerRepo.GetJournalIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, journalID := range journalIDs {
+		balanced, err := s.ledgerRepo.ValidateJournalBalance(journalID)
+		if err != nil {
+			return nil, err
+		}
+		if !balanced {
+			report.UnbalancedJournals = append(report.UnbalancedJournals, journalID)
+		}
+	}
+	report.JournalsChecked = len(journalIDs)
+
+	trialBalance, err := s.ledgerRepo.GetTrialBalance()
+	if err != nil {
+		return nil, err
+	}
+	report.TrialBalance = trialBalance
+
+	// Compare each account with the sum of its entries
+	accounts, err := s.accountRepo.GetAllAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := s.ledgerRepo.GetAccountTotals()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, account := range accounts {
+		stored := account.BalanceAvailable.Add(account.BalanceHold)
+		ledgerBalance := totals[account.ID]
+		if stored.Equal(ledgerBalance) {
+			continue
+		}
+
+		discrepancy := AccountDiscrepancy{
+			AccountID:     account.ID,
+			Currency:      account.Currency,
+			StoredBalance: stored,
+			LedgerBalance: ledgerBalance,
+			Difference:    stored.Sub(ledgerBalance),
+		}
+		if account.UserID != uuid.Nil {
+			userID := account.UserID
+			discrepancy.UserID = &userID
+		}
+
+		if repair {
+			repaired, err := s.repairAccount(account.ID)
+			if err != nil {
+				return nil, err
+			}
+			discrepancy.Repaired = repaired
+		}
+
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+	report.AccountsChecked = len(accounts)
+
+	return report, nil
+}
+
+// repairAccount rebuilds an account's available balance from its ledger entries,
+// leaving the hold untouched. It reports false when the hold alone exceeds the ledger.
+func (s *Service) repairAccount(accountID uuid.UUID) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the account and re-read its ledger so concurrent activity is not overwritten
+	account, err := s.accountRepo.GetAccountByIDForUpdate(tx, accountID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	ledgerBalance, err := s.ledgerRepo.GetAccountTotalTx(tx, accountID)
+	if err != nil {
+		return false, err
+	}
+
+	available := ledgerBalance.Sub(account.BalanceHold)
+	if available.LessThan(decimal.Zero) && account.UserID != uuid.Nil {
+		return false, nil
+	}
+
+	if err := s.accountRepo.UpdateAccountBalance(tx, accountID, available, account.BalanceHold); err != nil {
+		return false, fmt.Errorf("failed to update account balance: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
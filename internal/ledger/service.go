@@ -29,22 +29,42 @@ func NewService(db *sql.DB) *Service {
 
 // TopUpUser adds funds to a user's USD account
 func (s *Service) TopUpUser(userID uuid.UUID, amount decimal.Decimal) (*models.Account, error) {
-	if amount.LessThanOrEqual(decimal.Zero) {
-		return nil, fmt.Errorf("amount must be positive")
-	}
-
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get user's USD account
-	account, err := s.accountRepo.GetAccountByUserIDAndCurrency(userID, models.CurrencyUSD)
+	account, err := s.TopUpUserTx(tx, userID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return account, nil
+}
+
+// TopUpUserTx adds funds to a user's USD account within the caller's transaction
+func (s *Service) TopUpUserTx(tx *sql.Tx, userID uuid.UUID, amount decimal.Decimal) (*models.Account, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	// Get and lock user's USD account
+	account, err := s.accountRepo.GetAccountByUserIDAndCurrencyForUpdate(tx, userID, models.CurrencyUSD)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get USD account: %w", err)
 	}
 
+	// Paper money is issued out of the system equity account
+	equity, err := s.accountRepo.GetSystemAccountForUpdate(tx, models.SystemAccountEquity, models.CurrencyUSD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get equity account: %w", err)
+	}
+
 	// Create journal entries
 	journalID := uuid.New()
 	entries := []models.LedgerEntry{
@@ -58,7 +78,7 @@ func (s *Service) TopUpUser(userID uuid.UUID, amount decimal.Decimal) (*models.A
 		},
 		{
 			JournalID: journalID,
-			AccountID: uuid.Nil,     // System equity account (placeholder)
+			AccountID: equity.ID,
 			Amount:    amount.Neg(), // Debit system equity
 			Currency:  models.CurrencyUSD,
 			RefType:   "TOPUP",
@@ -71,14 +91,14 @@ func (s *Service) TopUpUser(userID uuid.UUID, amount decimal.Decimal) (*models.A
 		return nil, fmt.Errorf("failed to create journal: %w", err)
 	}
 
-	// Update account balance
+	// Update account balances
 	newBalance := account.BalanceAvailable.Add(amount)
 	if err := s.accountRepo.UpdateAccountBalance(tx, account.ID, newBalance, account.BalanceHold); err != nil {
 		return nil, fmt.Errorf("failed to update account balance: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	if err := s.accountRepo.UpdateAccountBalance(tx, equity.ID, equity.BalanceAvailable.Sub(amount), equity.BalanceHold); err != nil {
+		return nil, fmt.Errorf("failed to update equity balance: %w", err)
 	}
 
 	// Return updated account
@@ -86,20 +106,43 @@ func (s *Service) TopUpUser(userID uuid.UUID, amount decimal.Decimal) (*models.A
 	return account, nil
 }
 
+// GetSystemAccount looks up a system account from the chart of accounts
+func (s *Service) GetSystemAccount(code models.SystemAccount, currency models.Currency) (*models.Account, error) {
+	return s.accountRepo.GetSystemAccount(code, currency)
+}
+
+// TrialBalance returns the sum of all ledger entries per currency, which is zero for a sound ledger
+func (s *Service) TrialBalance() (map[models.Currency]decimal.Decimal, error) {
+	return s.ledgerRepo.GetTrialBalance()
+}
+
 // HoldFunds places a hold on funds for an order
 func (s *Service) HoldFunds(userID uuid.UUID, currency models.Currency, amount decimal.Decimal) error {
-	if amount.LessThanOrEqual(decimal.Zero) {
-		return fmt.Errorf("amount must be positive")
-	}
-
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get user's account
-	account, err := s.accountRepo.GetAccountByUserIDAndCurrency(userID, currency)
+	if err := s.HoldFundsTx(tx, userID, currency, amount); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// HoldFundsTx places a hold on funds within the caller's transaction
+func (s *Service) HoldFundsTx(tx *sql.Tx, userID uuid.UUID, currency models.Currency, amount decimal.Decimal) error {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	// Get and lock user's account
+	account, err := s.accountRepo.GetAccountByUserIDAndCurrencyForUpdate(tx, userID, currency)
 	if err != nil {
 		return fmt.Errorf("failed to get account: %w", err)
 	}
@@ -118,27 +161,36 @@ func (s *Service) HoldFunds(userID uuid.UUID, currency models.Currency, amount d
 		return fmt.Errorf("failed to update account balance: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
 	return nil
 }
 
 // ReleaseHold releases held funds back to available
 func (s *Service) ReleaseHold(userID uuid.UUID, currency models.Currency, amount decimal.Decimal) error {
-	if amount.LessThanOrEqual(decimal.Zero) {
-		return fmt.Errorf("amount must be positive")
-	}
-
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get user's account
-	account, err := s.accountRepo.GetAccountByUserIDAndCurrency(userID, currency)
+	if err := s.ReleaseHoldTx(tx, userID, currency, amount); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseHoldTx releases held funds back to available within the caller's transaction
+func (s *Service) ReleaseHoldTx(tx *sql.Tx, userID uuid.UUID, currency models.Currency, amount decimal.Decimal) error {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	// Get and lock user's account
+	account, err := s.accountRepo.GetAccountByUserIDAndCurrencyForUpdate(tx, userID, currency)
 	if err != nil {
 		return fmt.Errorf("failed to get account: %w", err)
 	}
@@ -157,32 +209,41 @@ func (s *Service) ReleaseHold(userID uuid.UUID, currency models.Currency, amount
 		return fmt.Errorf("failed to update account balance: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
 	return nil
 }
 
 // TransferFunds transfers funds between accounts (for trades)
 func (s *Service) TransferFunds(fromAccountID, toAccountID uuid.UUID, amount decimal.Decimal, currency models.Currency, refType string, refID uuid.UUID) error {
-	if amount.LessThanOrEqual(decimal.Zero) {
-		return fmt.Errorf("amount must be positive")
-	}
-
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get accounts
-	fromAccount, err := s.accountRepo.GetAccountByID(fromAccountID)
+	if err := s.TransferFundsTx(tx, fromAccountID, toAccountID, amount, currency, refType, refID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// TransferFundsTx transfers funds between accounts within the caller's transaction
+func (s *Service) TransferFundsTx(tx *sql.Tx, fromAccountID, toAccountID uuid.UUID, amount decimal.Decimal, currency models.Currency, refType string, refID uuid.UUID) error {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("amount must be positive")
+	}
+
+	// Get and lock accounts
+	fromAccount, err := s.accountRepo.GetAccountByIDForUpdate(tx, fromAccountID)
 	if err != nil {
 		return fmt.Errorf("failed to get from account: %w", err)
 	}
 
-	toAccount, err := s.accountRepo.GetAccountByID(toAccountID)
+	toAccount, err := s.accountRepo.GetAccountByIDForUpdate(tx, toAccountID)
 	if err != nil {
 		return fmt.Errorf("failed to get to account: %w", err)
 	}
@@ -231,9 +292,214 @@ func (s *Service) TransferFunds(fromAccountID, toAccountID uuid.UUID, amount dec
 		return fmt.Errorf("failed to update to account balance: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	return nil
+}
+
+// Settlement describes a single fill to be settled between a buyer and a seller
+type Settlement struct {
+	TradeID       uuid.UUID
+	BaseCurrency  models.Currency
+	QuoteCurrency models.Currency
+	Price         decimal.Decimal
+	Qty           decimal.Decimal
+	// BuyerID or SellerID is uuid.Nil when that side is the simulated liquidity
+	// provider, which trades out of the market-maker inventory accounts
+	BuyerID  uuid.UUID
+	SellerID uuid.UUID
+	// BuyerHoldPrice is the price the buyer's quote currency hold was sized at
+	BuyerHoldPrice decimal.Decimal
+	// Each side pays its fee out of what it receives: the buyer in the base
+	// currency, the seller in the quote currency
+	BuyerFee  decimal.Decimal
+	SellerFee decimal.Decimal
+}
+
+// SettleTradeTx settles a fill out of both parties' holds within the caller's transaction.
+// The buyer's hold is consumed at the hold price and any price improvement is released
+// back to available; the seller's base currency hold is consumed one for one.
+func (s *Service) SettleTradeTx(tx *sql.Tx, settlement *Settlement) error {
+	if settlement.Qty.LessThanOrEqual(decimal.Zero) || settlement.Price.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("price and quantity must be positive")
+	}
+	if settlement.BuyerFee.IsNegative() || settlement.SellerFee.IsNegative() {
+		return fmt.Errorf("fees cannot be negative")
+	}
+
+	value := settlement.Price.Mul(settlement.Qty)
+	buyerHold := settlement.BuyerHoldPrice.Mul(settlement.Qty)
+
+	// A self-trade touches the same accounts from both sides, so every account
+	// is loaded once and all movements are applied to that single copy
+	accounts := make(map[uuid.UUID]*models.Account)
+	var touched []*models.Account
+	track := func(account *models.Account) *models.Account {
+		if existing, ok := accounts[account.ID]; ok {
+			return existing
+		}
+		accounts[account.ID] = account
+		touched = append(touched, account)
+		return account
+	}
+	lock := func(userID uuid.UUID, currency models.Currency) (*models.Account, error) {
+		var account *models.Account
+		var err error
+		if userID == uuid.Nil {
+			account, err = s.accountRepo.GetSystemAccountForUpdate(tx, models.SystemAccountMMInventory, currency)
+		} else {
+			account, err = s.accountRepo.GetAccountByUserIDAndCurrencyForUpdate(tx, userID, currency)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s account: %w", currency, err)
+		}
+		return track(account), nil
+	}
+	lockFeeRevenue := func(currency models.Currency) (*models.Account, error) {
+		account, err := s.accountRepo.GetSystemAccountForUpdate(tx, models.SystemAccountFeeRevenue, currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s fee revenue account: %w", currency, err)
+		}
+		return track(account), nil
+	}
+
+	buyerQuote, err := lock(settlement.BuyerID, settlement.QuoteCurrency)
+	if err != nil {
+		return err
+	}
+	buyerBase, err := lock(settlement.BuyerID, settlement.BaseCurrency)
+	if err != nil {
+		return err
+	}
+	sellerQuote, err := lock(settlement.SellerID, settlement.QuoteCurrency)
+	if err != nil {
+		return err
+	}
+	sellerBase, err := lock(settlement.SellerID, settlement.BaseCurrency)
+	if err != nil {
+		return err
+	}
+
+	// Buyer pays out of the hold; a fill better than the hold price releases the
+	// difference, a worse one (market orders) is charged to available
+	if settlement.BuyerID == uuid.Nil {
+		buyerHold = decimal.Zero
+	}
+	buyerQuote.BalanceHold = buyerQuote.BalanceHold.Sub(buyerHold)
+	buyerQuote.BalanceAvailable = buyerQuote.BalanceAvailable.Add(buyerHold.Sub(value))
+	buyerBase.BalanceAvailable = buyerBase.BalanceAvailable.Add(settlement.Qty.Sub(settlement.BuyerFee))
+
+	// Seller delivers out of the hold and receives the proceeds; the liquidity
+	// provider holds nothing and delivers out of inventory
+	if settlement.SellerID == uuid.Nil {
+		sellerBase.BalanceAvailable = sellerBase.BalanceAvailable.Sub(settlement.Qty)
+	} else {
+		sellerBase.BalanceHold = sellerBase.BalanceHold.Sub(settlement.Qty)
+	}
+	sellerQuote.BalanceAvailable = sellerQuote.BalanceAvailable.Add(value.Sub(settlement.SellerFee))
+
+	// Fees move from what each side received into fee revenue
+	var feeBase, feeQuote *models.Account
+	if settlement.BuyerFee.IsPositive() {
+		if feeBase, err = lockFeeRevenue(settlement.BaseCurrency); err != nil {
+			return err
+		}
+		feeBase.BalanceAvailable = feeBase.BalanceAvailable.Add(settlement.BuyerFee)
+	}
+	if settlement.SellerFee.IsPositive() {
+		if feeQuote, err = lockFeeRevenue(settlement.QuoteCurrency); err != nil {
+			return err
+		}
+		feeQuote.BalanceAvailable = feeQuote.BalanceAvailable.Add(settlement.SellerFee)
+	}
+
+	for _, account := range touched {
+		// Inventory is allowed to run short like the other system accounts
+		if account.UserID == uuid.Nil {
+			continue
+		}
+		if account.BalanceHold.LessThan(decimal.Zero) {
+			return fmt.Errorf("insufficient held funds in %s account", account.Currency)
+		}
+		if account.BalanceAvailable.LessThan(decimal.Zero) {
+			return fmt.Errorf("insufficient funds in %s account", account.Currency)
+		}
+	}
+
+	// One balanced journal per fill: quote and base legs each net to zero
+	journalID := uuid.New()
+	entries := []models.LedgerEntry{
+		{
+			JournalID: journalID,
+			AccountID: buyerQuote.ID,
+			Amount:    value.Neg(), // Debit buyer's quote currency
+			Currency:  settlement.QuoteCurrency,
+			RefType:   "TRADE",
+			RefID:     settlement.TradeID,
+		},
+		{
+			JournalID: journalID,
+			AccountID: sellerQuote.ID,
+			Amount:    value, // Credit seller's quote currency
+			Currency:  settlement.QuoteCurrency,
+			RefType:   "TRADE",
+			RefID:     settlement.TradeID,
+		},
+		{
+			JournalID: journalID,
+			AccountID: sellerBase.ID,
+			Amount:    settlement.Qty.Neg(), // Debit seller's base currency
+			Currency:  settlement.BaseCurrency,
+			RefType:   "TRADE",
+			RefID:     settlement.TradeID,
+		},
+		{
+			JournalID: journalID,
+			AccountID: buyerBase.ID,
+			Amount:    settlement.Qty, // Credit buyer's base currency
+			Currency:  settlement.BaseCurrency,
+			RefType:   "TRADE",
+			RefID:     settlement.TradeID,
+		},
+	}
+
+	// Fee legs join the same journal so a fill and its fees post atomically
+	if feeBase != nil {
+		entries = append(entries, feeEntries(journalID, buyerBase, feeBase, settlement.BuyerFee, settlement.TradeID)...)
+	}
+	if feeQuote != nil {
+		entries = append(entries, feeEntries(journalID, sellerQuote, feeQuote, settlement.SellerFee, settlement.TradeID)...)
+	}
+
+	if err := s.ledgerRepo.CreateJournal(tx, entries); err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	for _, account := range touched {
+		if err := s.accountRepo.UpdateAccountBalance(tx, account.ID, account.BalanceAvailable, account.BalanceHold); err != nil {
+			return fmt.Errorf("failed to update account balance: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// feeEntries moves a fee from the payer's account into fee revenue
+func feeEntries(journalID uuid.UUID, payer, revenue *models.Account, fee decimal.Decimal, tradeID uuid.UUID) []models.LedgerEntry {
+	return []models.LedgerEntry{
+		{
+			JournalID: journalID,
+			AccountID: payer.ID,
+			Amount:    fee.Neg(), // Debit the fee from what the payer received
+			Currency:  payer.Currency,
+			RefType:   "FEE",
+			RefID:     tradeID,
+		},
+		{
+			JournalID: journalID,
+			AccountID: revenue.ID,
+			Amount:    fee, // Credit fee revenue
+			Currency:  revenue.Currency,
+			RefType:   "FEE",
+			RefID:     tradeID,
+		},
+	}
+}
@@ -4,44 +4,62 @@ import (
 	"container/heap"
 )
 
-// PriceHeap implements a heap for price levels
-type PriceHeap []*PriceLevel
+// PriceHeap implements a heap for price levels. Bids are ordered highest price
+// first and asks lowest price first, so the best level is always at index 0.
+type PriceHeap struct {
+	levels []*PriceLevel
+	isBid  bool
+}
 
 // NewPriceHeap creates a new price heap
 func NewPriceHeap(isBid bool) *PriceHeap {
-	h := &PriceHeap{}
+	h := &PriceHeap{isBid: isBid}
 	heap.Init(h)
 	return h
 }
 
 // Len returns the length of the heap
 func (h PriceHeap) Len() int {
-	return len(h)
+	return len(h.levels)
 }
 
 // Less compares two price levels
 func (h PriceHeap) Less(i, j int) bool {
-	// For bids (buy orders), we want highest price first (max heap)
-	// For asks (sell orders), we want lowest price first (min heap)
-	// This is determined by the isBid flag when creating the heap
-	return h[i].Price.LessThan(h[j].Price)
+	if h.isBid {
+		return h.levels[i].Price.GreaterThan(h.levels[j].Price)
+	}
+	return h.levels[i].Price.LessThan(h.levels[j].Price)
 }
 
-// Swap swaps two price levels
+// Swap swaps two price levels and keeps their indexes in step
 func (h PriceHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
+	h.levels[i], h.levels[j] = h.levels[j], h.levels[i]
+	h.levels[i].index = i
+	h.levels[j].index = j
 }
 
 // Push adds a price level to the heap
 func (h *PriceHeap) Push(x interface{}) {
-	*h = append(*h, x.(*PriceLevel))
+	level := x.(*PriceLevel)
+	level.index = len(h.levels)
+	h.levels = append(h.levels, level)
 }
 
-// Pop removes and returns the top price level
+// Pop removes and returns the last price level
 func (h *PriceHeap) Pop() interface{} {
-	old := *h
+	old := h.levels
 	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
+	level := old[n-1]
+	old[n-1] = nil
+	level.index = -1
+	h.levels = old[0 : n-1]
+	return level
+}
+
+// Peek returns the best price level without removing it
+func (h *PriceHeap) Peek() (*PriceLevel, bool) {
+	if len(h.levels) == 0 {
+		return nil, false
+	}
+	return h.levels[0], true
 }
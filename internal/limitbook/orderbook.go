@@ -2,6 +2,7 @@ package limitbook
 
 import (
 	"container/heap"
+	"sort"
 	"sync"
 	"time"
 
@@ -22,18 +23,72 @@ type Order struct {
 	Qty       decimal.Decimal    `json:"qty"`
 	FilledQty decimal.Decimal    `json:"filled_qty"`
 	Status    models.OrderStatus `json:"status"`
+	PostOnly  bool               `json:"post_only"`
+	StopPrice *decimal.Decimal   `json:"stop_price,omitempty"`
 	CreatedAt time.Time          `json:"created_at"`
+	// Trailing stops move StopPrice by one of these as the quote moves in their favor
+	TrailOffset  *decimal.Decimal `json:"trail_offset,omitempty"`
+	TrailPercent *decimal.Decimal `json:"trail_percent,omitempty"`
+	// Icebergs show DisplayQty at a time and requeue each time a slice fills
+	DisplayQty *decimal.Decimal `json:"display_qty,omitempty"`
 }
 
-// PriceLevel represents a price level in the book
+// VisibleQty returns the quantity an order shows in the book: the rest of its
+// current slice for an iceberg, its whole remaining quantity otherwise. Slices
+// start at every multiple of DisplayQty filled.
+func (o *Order) VisibleQty() decimal.Decimal {
+	remaining := o.Qty.Sub(o.FilledQty)
+	if o.DisplayQty == nil {
+		return remaining
+	}
+	slice := o.DisplayQty.Sub(o.FilledQty.Mod(*o.DisplayQty))
+	return decimal.Min(slice, remaining)
+}
+
+// sliceFilled reports whether an iceberg has just filled its visible slice and
+// has hidden quantity left to show
+func (o *Order) sliceFilled() bool {
+	return o.DisplayQty != nil && o.FilledQty.LessThan(o.Qty) && o.FilledQty.Mod(*o.DisplayQty).IsZero()
+}
+
+// DepthLevel aggregates the visible quantity resting at one price
+type DepthLevel struct {
+	Price  decimal.Decimal `json:"price"`
+	Qty    decimal.Decimal `json:"qty"`
+	Orders int             `json:"orders"`
+}
+
+// Snapshot is the visible depth of both sides of a book, best prices first, as of
+// the book's Sequence
+type Snapshot struct {
+	Symbol   models.Symbol `json:"symbol"`
+	Sequence uint64        `json:"sequence"`
+	Bids     []DepthLevel  `json:"bids"`
+	Asks     []DepthLevel  `json:"asks"`
+}
+
+// BookUpdate carries the new visible depth of every price level one change to a
+// book touched, at the book's new Sequence. A level with no orders left has zero
+// quantity and should be removed.
+type BookUpdate struct {
+	Symbol   models.Symbol `json:"symbol"`
+	Sequence uint64        `json:"sequence"`
+	Bids     []DepthLevel  `json:"bids"`
+	Asks     []DepthLevel  `json:"asks"`
+}
+
+// PriceLevel represents a price level in the book. Orders are kept in time
+// priority, oldest first.
 type PriceLevel struct {
 	Price  decimal.Decimal
 	Orders []*Order
+	index  int // position in the heap, maintained by PriceHeap
 }
 
 // BookSide represents one side of the order book (bids or asks)
 type BookSide struct {
 	levels map[string]*PriceLevel // price string -> price level
+	orders map[uuid.UUID]*Order   // order ID -> resting order
 	heap   *PriceHeap
 	mutex  sync.RWMutex
 }
@@ -42,11 +97,12 @@ type BookSide struct {
 func NewBookSide(isBid bool) *BookSide {
 	return &BookSide{
 		levels: make(map[string]*PriceLevel),
+		orders: make(map[uuid.UUID]*Order),
 		heap:   NewPriceHeap(isBid),
 	}
 }
 
-// AddOrder adds an order to the book side
+// AddOrder adds an order to the back of its price level
 func (bs *BookSide) AddOrder(order *Order) {
 	bs.mutex.Lock()
 	defer bs.mutex.Unlock()
@@ -64,32 +120,70 @@ func (bs *BookSide) AddOrder(order *Order) {
 	}
 
 	level.Orders = append(level.Orders, order)
+	bs.orders[order.ID] = order
 }
 
-// RemoveOrder removes an order from the book side
-func (bs *BookSide) RemoveOrder(orderID uuid.UUID) bool {
+// RemoveOrder removes an order from the book side and returns it. A level left
+// empty is removed from the heap in O(log n).
+func (bs *BookSide) RemoveOrder(orderID uuid.UUID) (*Order, bool) {
 	bs.mutex.Lock()
 	defer bs.mutex.Unlock()
 
-	for priceStr, level := range bs.levels {
-		for i, order := range level.Orders {
-			if order.ID == orderID {
-				// Remove order from level
-				level.Orders = append(level.Orders[:i], level.Orders[i+1:]...)
-
-				// If level is empty, remove it
-				if len(level.Orders) == 0 {
-					delete(bs.levels, priceStr)
-					// Note: We don't remove from heap here for simplicity
-					// In production, you'd want to implement heap removal
-				}
-
-				return true
-			}
+	order, exists := bs.orders[orderID]
+	if !exists {
+		return nil, false
+	}
+	delete(bs.orders, orderID)
+
+	priceStr := order.Price.String()
+	level := bs.levels[priceStr]
+	for i, resting := range level.Orders {
+		if resting.ID == orderID {
+			level.Orders = append(level.Orders[:i], level.Orders[i+1:]...)
+			break
+		}
+	}
+
+	if len(level.Orders) == 0 {
+		delete(bs.levels, priceStr)
+		heap.Remove(bs.heap, level.index)
+	}
+
+	return order, true
+}
+
+// requeueOrder moves a resting order to the back of its price level
+func (bs *BookSide) requeueOrder(order *Order) {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+
+	level := bs.levels[order.Price.String()]
+	for i, resting := range level.Orders {
+		if resting.ID == order.ID {
+			level.Orders = append(level.Orders[:i], level.Orders[i+1:]...)
+			break
 		}
 	}
+	level.Orders = append(level.Orders, order)
+}
+
+// clear removes every order from the book side
+func (bs *BookSide) clear() {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
 
-	return false
+	bs.levels = make(map[string]*PriceLevel)
+	bs.orders = make(map[uuid.UUID]*Order)
+	bs.heap = NewPriceHeap(bs.heap.isBid)
+}
+
+// GetOrder looks up a resting order by ID
+func (bs *BookSide) GetOrder(orderID uuid.UUID) (*Order, bool) {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	order, exists := bs.orders[orderID]
+	return order, exists
 }
 
 // GetBestPrice returns the best price (highest bid or lowest ask)
@@ -97,35 +191,136 @@ func (bs *BookSide) GetBestPrice() (*decimal.Decimal, bool) {
 	bs.mutex.RLock()
 	defer bs.mutex.RUnlock()
 
-	if bs.heap.Len() == 0 {
+	level, exists := bs.heap.Peek()
+	if !exists {
 		return nil, false
 	}
-
-	level := (*bs.heap)[0]
 	return &level.Price, true
 }
 
-// GetBestLevel returns the best price level
+// GetBestLevel returns the best price level, which is never empty
 func (bs *BookSide) GetBestLevel() (*PriceLevel, bool) {
 	bs.mutex.RLock()
 	defer bs.mutex.RUnlock()
 
-	if bs.heap.Len() == 0 {
-		return nil, false
+	return bs.heap.Peek()
+}
+
+// forEachLevel calls fn for each price level in no particular order until fn returns false
+func (bs *BookSide) forEachLevel(fn func(level *PriceLevel) bool) {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	for _, level := range bs.levels {
+		if !fn(level) {
+			return
+		}
+	}
+}
+
+// Levels returns the visible quantity and order count of the best depth price
+// levels, best first; a depth of zero or less returns every level
+func (bs *BookSide) Levels(depth int) []DepthLevel {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	levels := make([]DepthLevel, 0, len(bs.levels))
+	for _, level := range bs.levels {
+		levels = append(levels, depthOf(level))
+	}
+
+	bs.sortLevels(levels)
+	if depth > 0 && len(levels) > depth {
+		levels = levels[:depth]
+	}
+
+	return levels
+}
+
+// levelsAt returns the visible depth at each of prices, best first, with zero
+// quantity where no orders rest
+func (bs *BookSide) levelsAt(prices map[string]decimal.Decimal) []DepthLevel {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	levels := make([]DepthLevel, 0, len(prices))
+	for priceStr, price := range prices {
+		level, exists := bs.levels[priceStr]
+		if !exists {
+			levels = append(levels, DepthLevel{Price: price, Qty: decimal.Zero})
+			continue
+		}
+		levels = append(levels, depthOf(level))
+	}
+
+	bs.sortLevels(levels)
+	return levels
+}
+
+// prices returns the price of every level on the book side, keyed by price string
+func (bs *BookSide) prices() map[string]decimal.Decimal {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	prices := make(map[string]decimal.Decimal, len(bs.levels))
+	for priceStr, level := range bs.levels {
+		prices[priceStr] = level.Price
 	}
+	return prices
+}
 
-	level := (*bs.heap)[0]
-	return level, true
+// sortLevels orders depth levels best first for the side
+func (bs *BookSide) sortLevels(levels []DepthLevel) {
+	sort.Slice(levels, func(i, j int) bool {
+		if bs.heap.isBid {
+			return levels[i].Price.GreaterThan(levels[j].Price)
+		}
+		return levels[i].Price.LessThan(levels[j].Price)
+	})
 }
 
-// OrderBook represents the complete order book for a symbol
+// depthOf aggregates the visible quantity resting at a price level
+func depthOf(level *PriceLevel) DepthLevel {
+	qty := decimal.Zero
+	for _, order := range level.Orders {
+		qty = qty.Add(order.VisibleQty())
+	}
+	return DepthLevel{Price: level.Price, Qty: qty, Orders: len(level.Orders)}
+}
+
+// Len returns the number of resting orders
+func (bs *BookSide) Len() int {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	return len(bs.orders)
+}
+
+// Depth returns the number of price levels
+func (bs *BookSide) Depth() int {
+	bs.mutex.RLock()
+	defer bs.mutex.RUnlock()
+
+	return bs.heap.Len()
+}
+
+// OrderBook represents the complete order book for a symbol. Its sequence
+// number goes up by one with every change to the resting orders, so snapshots
+// taken at the same sequence show the same book, and each change is published
+// to subscribers as a BookUpdate.
 type OrderBook struct {
-	Symbol models.Symbol
-	Bids   *BookSide
-	Asks   *BookSide
-	mutex  sync.RWMutex
+	Symbol      models.Symbol
+	Bids        *BookSide
+	Asks        *BookSide
+	sequence    uint64
+	subscribers []chan *BookUpdate
+	mutex       sync.RWMutex
 }
 
+// bookUpdateBuffer is how many updates a subscriber may fall behind before
+// updates are dropped for it
+const bookUpdateBuffer = 100
+
 // NewOrderBook creates a new order book
 func NewOrderBook(symbol models.Symbol) *OrderBook {
 	return &OrderBook{
@@ -145,14 +340,163 @@ func (ob *OrderBook) AddOrder(order *Order) {
 	} else {
 		ob.Asks.AddOrder(order)
 	}
+	ob.changed(order.Side, *order.Price)
+}
+
+// RemoveOrder removes an order from the book and returns it
+func (ob *OrderBook) RemoveOrder(orderID uuid.UUID) (*Order, bool) {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	order, ok := ob.Bids.RemoveOrder(orderID)
+	if !ok {
+		order, ok = ob.Asks.RemoveOrder(orderID)
+	}
+	if ok {
+		ob.changed(order.Side, *order.Price)
+	}
+	return order, ok
+}
+
+// ReduceOrder lowers a resting order's total quantity in place, keeping its queue
+// position. The caller ensures qty stays above the filled quantity.
+func (ob *OrderBook) ReduceOrder(orderID uuid.UUID, qty decimal.Decimal) bool {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	order, ok := ob.Bids.GetOrder(orderID)
+	if !ok {
+		order, ok = ob.Asks.GetOrder(orderID)
+	}
+	if !ok {
+		return false
+	}
+
+	order.Qty = qty
+	ob.changed(order.Side, *order.Price)
+	return true
+}
+
+// Reset replaces every resting order with orders, as when the book is rebuilt
+// from storage. The sequence carries on rather than starting over.
+func (ob *OrderBook) Reset(orders []*Order) {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	// Every level that was or will be in the book may have changed
+	bidPrices := ob.Bids.prices()
+	askPrices := ob.Asks.prices()
+
+	ob.Bids.clear()
+	ob.Asks.clear()
+	for _, order := range orders {
+		if order.Side == models.OrderSideBuy {
+			ob.Bids.AddOrder(order)
+			bidPrices[order.Price.String()] = *order.Price
+		} else {
+			ob.Asks.AddOrder(order)
+			askPrices[order.Price.String()] = *order.Price
+		}
+	}
+	ob.publish(bidPrices, askPrices)
 }
 
-// RemoveOrder removes an order from the book
-func (ob *OrderBook) RemoveOrder(orderID uuid.UUID) bool {
+// changed records a change to one price level on one side of the book
+func (ob *OrderBook) changed(side models.OrderSide, price decimal.Decimal) {
+	prices := map[string]decimal.Decimal{price.String(): price}
+	if side == models.OrderSideBuy {
+		ob.publish(prices, nil)
+	} else {
+		ob.publish(nil, prices)
+	}
+}
+
+// publish advances the sequence for a change to the given price levels and sends
+// their new depth to every subscriber. A subscriber too far behind misses the
+// update and sees a gap in the sequence. Callers must hold ob.mutex for writing.
+func (ob *OrderBook) publish(bidPrices, askPrices map[string]decimal.Decimal) {
+	ob.sequence++
+	if len(ob.subscribers) == 0 {
+		return
+	}
+
+	update := &BookUpdate{
+		Symbol:   ob.Symbol,
+		Sequence: ob.sequence,
+		Bids:     ob.Bids.levelsAt(bidPrices),
+		Asks:     ob.Asks.levelsAt(askPrices),
+	}
+	for _, ch := range ob.subscribers {
+		select {
+		case ch <- update:
+		default:
+			// The subscriber is behind; it resyncs from a snapshot
+		}
+	}
+}
+
+// Subscribe returns a full snapshot of the book together with a channel of the
+// updates that follow it, starting at the snapshot's sequence plus one
+func (ob *OrderBook) Subscribe() (<-chan *BookUpdate, *Snapshot) {
 	ob.mutex.Lock()
 	defer ob.mutex.Unlock()
 
-	return ob.Bids.RemoveOrder(orderID) || ob.Asks.RemoveOrder(orderID)
+	ch := make(chan *BookUpdate, bookUpdateBuffer)
+	ob.subscribers = append(ob.subscribers, ch)
+
+	return ch, &Snapshot{
+		Symbol:   ob.Symbol,
+		Sequence: ob.sequence,
+		Bids:     ob.Bids.Levels(0),
+		Asks:     ob.Asks.Levels(0),
+	}
+}
+
+// Unsubscribe stops and closes a channel returned by Subscribe
+func (ob *OrderBook) Unsubscribe(ch <-chan *BookUpdate) {
+	ob.mutex.Lock()
+	defer ob.mutex.Unlock()
+
+	for i, subscriber := range ob.subscribers {
+		if subscriber == ch {
+			ob.subscribers = append(ob.subscribers[:i], ob.subscribers[i+1:]...)
+			close(subscriber)
+			break
+		}
+	}
+}
+
+// Sequence returns the number of changes made to the book so far
+func (ob *OrderBook) Sequence() uint64 {
+	ob.mutex.RLock()
+	defer ob.mutex.RUnlock()
+
+	return ob.sequence
+}
+
+// GetOrder looks up a resting order on either side of the book
+func (ob *OrderBook) GetOrder(orderID uuid.UUID) (*Order, bool) {
+	ob.mutex.RLock()
+	defer ob.mutex.RUnlock()
+
+	if order, ok := ob.Bids.GetOrder(orderID); ok {
+		return order, true
+	}
+	return ob.Asks.GetOrder(orderID)
+}
+
+// Snapshot returns the visible depth of the best depth levels on each side; a depth
+// of zero or less returns every level. Iceberg reserves are not shown.
+func (ob *OrderBook) Snapshot(depth int) *Snapshot {
+	ob.mutex.RLock()
+	defer ob.mutex.RUnlock()
+
+	return &Snapshot{
+		Symbol:   ob.Symbol,
+		Sequence: ob.sequence,
+		Bids:     ob.Bids.Levels(depth),
+		Asks:     ob.Asks.Levels(depth),
+	}
 }
 
 // GetBestBid returns the best bid price
@@ -178,135 +522,123 @@ func (ob *OrderBook) GetSpread() (*decimal.Decimal, bool) {
 	return &spread, true
 }
 
-// MatchOrder attempts to match an order against the book
+// opposite returns the side an order trades against and whether a price on that
+// side is marketable for it. Buys take the asks up to their price, sells take the
+// bids down to theirs.
+func (ob *OrderBook) opposite(order *Order) (*BookSide, func(decimal.Decimal) bool) {
+	if order.Side == models.OrderSideSell {
+		return ob.Bids, func(price decimal.Decimal) bool {
+			return order.Price == nil || price.GreaterThanOrEqual(*order.Price)
+		}
+	}
+	return ob.Asks, func(price decimal.Decimal) bool {
+		return order.Price == nil || price.LessThanOrEqual(*order.Price)
+	}
+}
+
+// WouldCross reports whether an order is marketable against the opposite best price
+func (ob *OrderBook) WouldCross(order *Order) bool {
+	ob.mutex.RLock()
+	defer ob.mutex.RUnlock()
+
+	opposite, crosses := ob.opposite(order)
+	level, hasLevel := opposite.GetBestLevel()
+	return hasLevel && crosses(level.Price)
+}
+
+// FillableQty returns how much of an order's remaining quantity the book could
+// fill right now without changing anything, iceberg reserves included
+func (ob *OrderBook) FillableQty(order *Order) decimal.Decimal {
+	ob.mutex.RLock()
+	defer ob.mutex.RUnlock()
+
+	opposite, crosses := ob.opposite(order)
+	remainingQty := order.Qty.Sub(order.FilledQty)
+
+	available := decimal.Zero
+	opposite.forEachLevel(func(level *PriceLevel) bool {
+		if !crosses(level.Price) {
+			return true
+		}
+		for _, resting := range level.Orders {
+			available = available.Add(resting.Qty.Sub(resting.FilledQty))
+		}
+		return available.LessThan(remainingQty)
+	})
+
+	return decimal.Min(available, remainingQty)
+}
+
+// MatchOrder attempts to match an order against the book. Orders with a price,
+// including market orders carrying a protection price, only fill at or better than it.
+// Resting orders fill in price-time priority and leave the book once fully filled.
+// Icebergs fill a visible slice at a time and go to the back of their level after
+// each one. Post-only orders never match; callers check WouldCross before resting them.
 func (ob *OrderBook) MatchOrder(order *Order) []*models.Trade {
 	ob.mutex.Lock()
 	defer ob.mutex.Unlock()
 
+	// Post-only orders only ever add liquidity
+	if order.PostOnly {
+		return nil
+	}
+
+	opposite, crosses := ob.opposite(order)
+
 	var trades []*models.Trade
+	touched := make(map[string]decimal.Decimal)
 	remainingQty := order.Qty.Sub(order.FilledQty)
 
-	if order.Side == models.OrderSideBuy {
-		// Match against asks
-		for remainingQty.GreaterThan(decimal.Zero) {
-			level, hasLevel := ob.Asks.GetBestLevel()
-			if !hasLevel {
-				break
-			}
-
-			// Check if we can match at this price
-			if order.Type == models.OrderTypeLimit && order.Price != nil && level.Price.GreaterThan(*order.Price) {
-				break
-			}
-
-			// Match against orders in this level
-			for i, askOrder := range level.Orders {
-				if remainingQty.LessThanOrEqual(decimal.Zero) {
-					break
-				}
-
-				askRemaining := askOrder.Qty.Sub(askOrder.FilledQty)
-				if askRemaining.LessThanOrEqual(decimal.Zero) {
-					continue
-				}
-
-				// Calculate fill quantity
-				fillQty := decimal.Min(remainingQty, askRemaining)
-
-				// Create trade
-				trade := &models.Trade{
-					ID:        uuid.New(),
-					Symbol:    order.Symbol,
-					Side:      order.Side,
-					Price:     level.Price,
-					Qty:       fillQty,
-					TakerID:   order.UserID,
-					MakerID:   askOrder.UserID,
-					CreatedAt: time.Now(),
-				}
-				trades = append(trades, trade)
-
-				// Update order quantities
-				order.FilledQty = order.FilledQty.Add(fillQty)
-				askOrder.FilledQty = askOrder.FilledQty.Add(fillQty)
-
-				// Update remaining quantity
-				remainingQty = remainingQty.Sub(fillQty)
-
-				// Remove filled order from level
-				if askOrder.FilledQty.Equal(askOrder.Qty) {
-					level.Orders = append(level.Orders[:i], level.Orders[i+1:]...)
-					askOrder.Status = models.OrderStatusFilled
-				} else {
-					askOrder.Status = models.OrderStatusPartiallyFilled
-				}
-			}
-
-			// Remove empty levels
-			if len(level.Orders) == 0 {
-				ob.Asks.RemoveOrder(uuid.Nil) // This won't work properly, but for simplicity
-			}
+	for remainingQty.GreaterThan(decimal.Zero) {
+		level, hasLevel := opposite.GetBestLevel()
+		if !hasLevel || !crosses(level.Price) {
+			break
 		}
-	} else {
-		// Match against bids (similar logic)
-		for remainingQty.GreaterThan(decimal.Zero) {
-			level, hasLevel := ob.Bids.GetBestLevel()
-			if !hasLevel {
-				break
-			}
-
-			// Check if we can match at this price
-			if order.Type == models.OrderTypeLimit && order.Price != nil && level.Price.LessThan(*order.Price) {
-				break
-			}
-
-			// Match against orders in this level
-			for i, bidOrder := range level.Orders {
-				if remainingQty.LessThanOrEqual(decimal.Zero) {
-					break
-				}
-
-				bidRemaining := bidOrder.Qty.Sub(bidOrder.FilledQty)
-				if bidRemaining.LessThanOrEqual(decimal.Zero) {
-					continue
-				}
-
-				// Calculate fill quantity
-				fillQty := decimal.Min(remainingQty, bidRemaining)
-
-				// Create trade
-				trade := &models.Trade{
-					ID:        uuid.New(),
-					Symbol:    order.Symbol,
-					Side:      order.Side,
-					Price:     level.Price,
-					Qty:       fillQty,
-					TakerID:   order.UserID,
-					MakerID:   bidOrder.UserID,
-					CreatedAt: time.Now(),
-				}
-				trades = append(trades, trade)
-
-				// Update order quantities
-				order.FilledQty = order.FilledQty.Add(fillQty)
-				bidOrder.FilledQty = bidOrder.FilledQty.Add(fillQty)
-
-				// Update remaining quantity
-				remainingQty = remainingQty.Sub(fillQty)
-
-				// Remove filled order from level
-				if bidOrder.FilledQty.Equal(bidOrder.Qty) {
-					level.Orders = append(level.Orders[:i], level.Orders[i+1:]...)
-					bidOrder.Status = models.OrderStatusFilled
-				} else {
-					bidOrder.Status = models.OrderStatusPartiallyFilled
-				}
-			}
-
-			// Remove empty levels
-			if len(level.Orders) == 0 {
-				ob.Bids.RemoveOrder(uuid.Nil) // This won't work properly, but for simplicity
-			}
+
+		// The oldest order at the best price fills first, up to what it shows
+		resting := level.Orders[0]
+		fillQty := decimal.Min(remainingQty, resting.VisibleQty())
+
+		trade := &models.Trade{
+			ID:           uuid.New(),
+			Symbol:       order.Symbol,
+			Side:         order.Side,
+			Price:        level.Price,
+			Qty:          fillQty,
+			TakerID:      order.UserID,
+			MakerID:      resting.UserID,
+			TakerOrderID: order.ID,
+			MakerOrderID: resting.ID,
+			CreatedAt:    time.Now(),
+		}
+		trades = append(trades, trade)
+		touched[level.Price.String()] = level.Price
+
+		// Update order quantities
+		order.FilledQty = order.FilledQty.Add(fillQty)
+		resting.FilledQty = resting.FilledQty.Add(fillQty)
+		remainingQty = remainingQty.Sub(fillQty)
+
+		// Remove filled orders, dropping the level once it is empty
+		if resting.FilledQty.GreaterThanOrEqual(resting.Qty) {
+			resting.Status = models.OrderStatusFilled
+			opposite.RemoveOrder(resting.ID)
+		} else {
+			resting.Status = models.OrderStatusPartiallyFilled
+		}
+
+		// An iceberg shows its next slice from the back of the level
+		if resting.sliceFilled() {
+			resting.CreatedAt = trade.CreatedAt
+			opposite.requeueOrder(resting)
+		}
+	}
+
+	if len(trades) > 0 {
+		if opposite == ob.Bids {
+			ob.publish(touched, nil)
+		} else {
+			ob.publish(nil, touched)
 		}
 	}
 
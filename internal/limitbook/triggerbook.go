@@ -0,0 +1,240 @@
+package limitbook
+
+import (
+	"container/heap"
+	"sync"
+
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// StopTriggered reports whether a quote crosses a stop price. Buy stops trigger
+// when the ask rises to the stop price, sell stops when the bid falls to it.
+func StopTriggered(side models.OrderSide, stopPrice, bid, ask decimal.Decimal) bool {
+	if side == models.OrderSideBuy {
+		return ask.GreaterThanOrEqual(stopPrice)
+	}
+	return bid.LessThanOrEqual(stopPrice)
+}
+
+// TrailingStopPrice returns the stop price a trailing stop keeps from the quote:
+// offset or percent below the bid for sells, above the ask for buys, rounded away
+// from the quote to a whole tick
+func TrailingStopPrice(side models.OrderSide, offset, percent *decimal.Decimal, bid, ask, tickSize decimal.Decimal) decimal.Decimal {
+	hundred := decimal.NewFromInt(100)
+	if side == models.OrderSideBuy {
+		price := ask
+		if offset != nil {
+			price = ask.Add(*offset)
+		} else if percent != nil {
+			price = ask.Mul(hundred.Add(*percent)).Div(hundred)
+		}
+		return price.Div(tickSize).Ceil().Mul(tickSize)
+	}
+
+	price := bid
+	if offset != nil {
+		price = bid.Sub(*offset)
+	} else if percent != nil {
+		price = bid.Mul(hundred.Sub(*percent)).Div(hundred)
+	}
+	return price.Div(tickSize).Floor().Mul(tickSize)
+}
+
+// TrailMove records a trailing stop moved by a quote and the stop price it left
+type TrailMove struct {
+	Order    *Order
+	Previous decimal.Decimal
+}
+
+// stopHeap orders untriggered stops on one side by how soon a moving quote
+// reaches them: buy stops lowest stop price first, sell stops highest first,
+// and the oldest first at the same stop price
+type stopHeap struct {
+	orders  []*Order
+	indexes map[uuid.UUID]int
+	isBuy   bool
+}
+
+// Len returns the length of the heap
+func (h stopHeap) Len() int {
+	return len(h.orders)
+}
+
+// Less compares two stops
+func (h stopHeap) Less(i, j int) bool {
+	a, b := h.orders[i], h.orders[j]
+	if !a.StopPrice.Equal(*b.StopPrice) {
+		if h.isBuy {
+			return a.StopPrice.LessThan(*b.StopPrice)
+		}
+		return a.StopPrice.GreaterThan(*b.StopPrice)
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// Swap swaps two stops and keeps their indexes in step
+func (h stopHeap) Swap(i, j int) {
+	h.orders[i], h.orders[j] = h.orders[j], h.orders[i]
+	h.indexes[h.orders[i].ID] = i
+	h.indexes[h.orders[j].ID] = j
+}
+
+// Push adds a stop to the heap
+func (h *stopHeap) Push(x interface{}) {
+	order := x.(*Order)
+	h.indexes[order.ID] = len(h.orders)
+	h.orders = append(h.orders, order)
+}
+
+// Pop removes and returns the last stop
+func (h *stopHeap) Pop() interface{} {
+	old := h.orders
+	n := len(old)
+	order := old[n-1]
+	old[n-1] = nil
+	delete(h.indexes, order.ID)
+	h.orders = old[0 : n-1]
+	return order
+}
+
+// TriggerBook holds the untriggered stop orders of a symbol apart from the
+// order book until the quote crosses their stop price
+type TriggerBook struct {
+	Symbol models.Symbol
+	buys   *stopHeap
+	sells  *stopHeap
+	mutex  sync.Mutex
+}
+
+// NewTriggerBook creates a new trigger book
+func NewTriggerBook(symbol models.Symbol) *TriggerBook {
+	return &TriggerBook{
+		Symbol: symbol,
+		buys:   &stopHeap{indexes: make(map[uuid.UUID]int), isBuy: true},
+		sells:  &stopHeap{indexes: make(map[uuid.UUID]int)},
+	}
+}
+
+// side returns the heap holding stops on the given side
+func (tb *TriggerBook) side(side models.OrderSide) *stopHeap {
+	if side == models.OrderSideBuy {
+		return tb.buys
+	}
+	return tb.sells
+}
+
+// AddStop adds an untriggered stop; the order must have a stop price
+func (tb *TriggerBook) AddStop(order *Order) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	heap.Push(tb.side(order.Side), order)
+}
+
+// RemoveStop removes an untriggered stop and returns it
+func (tb *TriggerBook) RemoveStop(orderID uuid.UUID) (*Order, bool) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	for _, h := range []*stopHeap{tb.buys, tb.sells} {
+		if index, ok := h.indexes[orderID]; ok {
+			return heap.Remove(h, index).(*Order), true
+		}
+	}
+	return nil, false
+}
+
+// GetStop looks up an untriggered stop by ID
+func (tb *TriggerBook) GetStop(orderID uuid.UUID) (*Order, bool) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	for _, h := range []*stopHeap{tb.buys, tb.sells} {
+		if index, ok := h.indexes[orderID]; ok {
+			return h.orders[index], true
+		}
+	}
+	return nil, false
+}
+
+// Triggered removes and returns every stop the quote crosses, buy stops first,
+// each side in the order a moving quote would have reached them
+func (tb *TriggerBook) Triggered(bid, ask decimal.Decimal) []*Order {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	var triggered []*Order
+	for _, h := range []*stopHeap{tb.buys, tb.sells} {
+		for h.Len() > 0 {
+			next := h.orders[0]
+			if !StopTriggered(next.Side, *next.StopPrice, bid, ask) {
+				break
+			}
+			triggered = append(triggered, heap.Pop(h).(*Order))
+		}
+	}
+
+	return triggered
+}
+
+// Trail ratchets every trailing stop towards the quote: sell stops rise with the
+// bid and buy stops fall with the ask, never the other way. It returns the stops
+// it moved.
+func (tb *TriggerBook) Trail(bid, ask, tickSize decimal.Decimal) []TrailMove {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	var moves []TrailMove
+	for _, h := range []*stopHeap{tb.buys, tb.sells} {
+		moved := false
+		for _, order := range h.orders {
+			if order.TrailOffset == nil && order.TrailPercent == nil {
+				continue
+			}
+
+			stopPrice := TrailingStopPrice(order.Side, order.TrailOffset, order.TrailPercent, bid, ask, tickSize)
+			favorable := stopPrice.GreaterThan(*order.StopPrice)
+			if h.isBuy {
+				favorable = stopPrice.LessThan(*order.StopPrice)
+			}
+			if !favorable {
+				continue
+			}
+
+			moves = append(moves, TrailMove{Order: order, Previous: *order.StopPrice})
+			order.StopPrice = &stopPrice
+			moved = true
+		}
+		if moved {
+			heap.Init(h)
+		}
+	}
+
+	return moves
+}
+
+// MoveStop sets an untriggered stop's stop price, keeping the trigger order
+func (tb *TriggerBook) MoveStop(orderID uuid.UUID, stopPrice decimal.Decimal) bool {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	for _, h := range []*stopHeap{tb.buys, tb.sells} {
+		if index, ok := h.indexes[orderID]; ok {
+			h.orders[index].StopPrice = &stopPrice
+			heap.Fix(h, index)
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of untriggered stops
+func (tb *TriggerBook) Len() int {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	return tb.buys.Len() + tb.sells.Len()
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -27,13 +29,40 @@ type TopUpResponse struct {
 	Balance decimal.Decimal `json:"balance"`
 }
 
-// CreateOrderRequest represents an order creation request
+// CreateOrderRequest represents an order creation request. TimeInForce defaults
+// to GTC; GTD orders require ExpiresAt. A post-only limit that would cross is
+// rejected, or with PostOnlyReprice moved one tick away from the opposite best.
+// Stop orders require StopPrice and wait untriggered until the quote crosses it.
+// Trailing stops take TrailOffset or TrailPercent instead and set their own
+// StopPrice from the quote. A resting limit order with DisplayQty is an iceberg
+// that shows only that much of its quantity at a time.
+// A buy entry may carry TakeProfit and StopLoss sells, which go live once the
+// entry stops working and cancel each other (OCO).
 type CreateOrderRequest struct {
-	Symbol Symbol           `json:"symbol" validate:"required"`
-	Side   OrderSide        `json:"side" validate:"required"`
-	Type   OrderType        `json:"type" validate:"required"`
-	Price  *decimal.Decimal `json:"price,omitempty"`
-	Qty    decimal.Decimal  `json:"qty" validate:"required,gt=0"`
+	Symbol          Symbol           `json:"symbol" validate:"required"`
+	Side            OrderSide        `json:"side" validate:"required"`
+	Type            OrderType        `json:"type" validate:"required"`
+	Price           *decimal.Decimal `json:"price,omitempty"`
+	Qty             decimal.Decimal  `json:"qty" validate:"required,gt=0"`
+	TimeInForce     TimeInForce      `json:"time_in_force,omitempty"`
+	ExpiresAt       *time.Time       `json:"expires_at,omitempty"`
+	PostOnly        bool             `json:"post_only,omitempty"`
+	PostOnlyReprice bool             `json:"post_only_reprice,omitempty"`
+	ReduceOnly      bool             `json:"reduce_only,omitempty"`
+	StopPrice       *decimal.Decimal `json:"stop_price,omitempty"`
+	TrailOffset     *decimal.Decimal `json:"trail_offset,omitempty"`
+	TrailPercent    *decimal.Decimal `json:"trail_percent,omitempty"`
+	DisplayQty      *decimal.Decimal `json:"display_qty,omitempty"`
+	TakeProfit      *BracketLeg      `json:"take_profit,omitempty"`
+	StopLoss        *BracketLeg      `json:"stop_loss,omitempty"`
+}
+
+// BracketLeg describes a take-profit or stop-loss child of an entry order. A
+// take-profit is a limit sell at Price; a stop-loss sells at market once the bid
+// falls to StopPrice, or at Price if one is given.
+type BracketLeg struct {
+	Price     *decimal.Decimal `json:"price,omitempty"`
+	StopPrice *decimal.Decimal `json:"stop_price,omitempty"`
 }
 
 // CreateOrderResponse represents an order creation response
@@ -42,6 +71,68 @@ type CreateOrderResponse struct {
 	Status       OrderStatus      `json:"status"`
 	FilledQty    decimal.Decimal  `json:"filled_qty"`
 	AvgFillPrice *decimal.Decimal `json:"avg_fill_price,omitempty"`
+	Fee          decimal.Decimal  `json:"fee"`
+	FeeCurrency  Currency         `json:"fee_currency,omitempty"`
+	Group        []OrderLink      `json:"group,omitempty"`
+}
+
+// OrderDetailResponse represents an order and, for bracket orders, its group
+type OrderDetailResponse struct {
+	Order
+	Group []OrderLink `json:"group,omitempty"`
+}
+
+// AmendOrderRequest represents a change to a resting limit order. Qty is the new
+// total quantity including what has already filled; omitted fields are unchanged.
+type AmendOrderRequest struct {
+	Price *decimal.Decimal `json:"price,omitempty"`
+	Qty   *decimal.Decimal `json:"qty,omitempty"`
+}
+
+// ListOrdersRequest represents order history filters and pagination
+type ListOrdersRequest struct {
+	Symbol      *Symbol
+	Side        *OrderSide
+	Status      *OrderStatus
+	Type        *OrderType
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Cursor      string
+	Limit       int
+}
+
+// ListOrdersResponse represents a page of order history
+type ListOrdersResponse struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// CreateAlgoOrderRequest represents an algo parent order. Slices defaults to one
+// per minute of the duration. VWAP orders may give a VolumeProfile with one weight
+// per slice; otherwise the symbol's recent traded volume at the same times of day
+// is used. Child orders are skipped while the quote is worse than LimitPrice.
+type CreateAlgoOrderRequest struct {
+	Symbol          Symbol            `json:"symbol" validate:"required"`
+	Side            OrderSide         `json:"side" validate:"required"`
+	Strategy        AlgoStrategy      `json:"strategy" validate:"required"`
+	Qty             decimal.Decimal   `json:"qty" validate:"required,gt=0"`
+	DurationSeconds int               `json:"duration_seconds" validate:"required,gt=0"`
+	Slices          int               `json:"slices,omitempty"`
+	LimitPrice      *decimal.Decimal  `json:"limit_price,omitempty"`
+	VolumeProfile   []decimal.Decimal `json:"volume_profile,omitempty"`
+}
+
+// AlgoOrderDetailResponse represents an algo order with its progress, schedule
+// and child orders. SlippageBps is the average fill price against the arrival
+// price in basis points, positive when the fills were worse.
+type AlgoOrderDetailResponse struct {
+	AlgoOrder
+	FilledQty    decimal.Decimal  `json:"filled_qty"`
+	RemainingQty decimal.Decimal  `json:"remaining_qty"`
+	AvgPrice     *decimal.Decimal `json:"avg_price,omitempty"`
+	SlippageBps  *decimal.Decimal `json:"slippage_bps,omitempty"`
+	Slices       []AlgoSlice      `json:"slices"`
+	Children     []Order          `json:"children"`
 }
 
 // ErrorResponse represents an error response
@@ -69,4 +160,11 @@ const (
 	ErrorCodeInvalidSymbol     = "INVALID_SYMBOL"
 	ErrorCodeInvalidOrderType  = "INVALID_ORDER_TYPE"
 	ErrorCodeOrderNotFound     = "ORDER_NOT_FOUND"
+	ErrorCodePostOnlyCross     = "POST_ONLY_WOULD_CROSS"
+	ErrorCodeReduceOnly        = "REDUCE_ONLY_EXCEEDS_POSITION"
+	ErrorCodeStopWouldTrigger  = "STOP_WOULD_TRIGGER"
+	ErrorCodeNotTrading        = "INSTRUMENT_NOT_TRADING"
+	ErrorCodeInvalidTickSize   = "INVALID_TICK_SIZE"
+	ErrorCodeInvalidLotSize    = "INVALID_LOT_SIZE"
+	ErrorCodeMinNotional       = "BELOW_MIN_NOTIONAL"
 )
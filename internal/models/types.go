@@ -7,15 +7,26 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-// Currency represents supported currencies
+// Currency represents a currency code; the listed currencies live in the
+// currencies table, these are the ones the platform refers to by name
 type Currency string
 
 const (
+	// CurrencyUSD is the currency paper money is issued and valued in
 	CurrencyUSD Currency = "USD"
 	CurrencyBTC Currency = "BTC"
 	CurrencyETH Currency = "ETH"
 )
 
+// SystemAccount identifies an exchange-owned account in the chart of accounts
+type SystemAccount string
+
+const (
+	SystemAccountEquity      SystemAccount = "EQUITY"
+	SystemAccountFeeRevenue  SystemAccount = "FEE_REVENUE"
+	SystemAccountMMInventory SystemAccount = "MM_INVENTORY"
+)
+
 // OrderSide represents buy or sell
 type OrderSide string
 
@@ -24,12 +35,19 @@ const (
 	OrderSideSell OrderSide = "SELL"
 )
 
-// OrderType represents market or limit orders
+// OrderType represents market, limit and stop orders
 type OrderType string
 
 const (
 	OrderTypeMarket OrderType = "MARKET"
 	OrderTypeLimit  OrderType = "LIMIT"
+	// OrderTypeStopMarket becomes a market order once its stop price is crossed
+	OrderTypeStopMarket OrderType = "STOP_MARKET"
+	// OrderTypeStopLimit becomes a limit order once its stop price is crossed
+	OrderTypeStopLimit OrderType = "STOP_LIMIT"
+	// OrderTypeTrailingStop becomes a market order once its stop price, which
+	// trails the quote, is crossed
+	OrderTypeTrailingStop OrderType = "TRAILING_STOP"
 )
 
 // OrderStatus represents order lifecycle states
@@ -41,9 +59,56 @@ const (
 	OrderStatusFilled          OrderStatus = "FILLED"
 	OrderStatusCanceled        OrderStatus = "CANCELED"
 	OrderStatusRejected        OrderStatus = "REJECTED"
+	OrderStatusExpired         OrderStatus = "EXPIRED"
+	// OrderStatusPending marks a bracket child waiting for its entry order to fill
+	OrderStatusPending OrderStatus = "PENDING"
+)
+
+// OrderLinkRole is an order's part in a bracket group
+type OrderLinkRole string
+
+const (
+	OrderLinkRoleParent     OrderLinkRole = "PARENT"
+	OrderLinkRoleTakeProfit OrderLinkRole = "TAKE_PROFIT"
+	OrderLinkRoleStopLoss   OrderLinkRole = "STOP_LOSS"
+)
+
+// AlgoStrategy is how an algo order spreads its quantity over its duration
+type AlgoStrategy string
+
+const (
+	// AlgoStrategyTWAP trades the same quantity in every slice
+	AlgoStrategyTWAP AlgoStrategy = "TWAP"
+	// AlgoStrategyVWAP trades each slice in proportion to a volume profile
+	AlgoStrategyVWAP AlgoStrategy = "VWAP"
+)
+
+// AlgoStatus represents the lifecycle of an algo order
+type AlgoStatus string
+
+const (
+	AlgoStatusRunning   AlgoStatus = "RUNNING"
+	AlgoStatusCompleted AlgoStatus = "COMPLETED"
+	// AlgoStatusExpired marks an algo that ran its schedule without filling in full
+	AlgoStatusExpired  AlgoStatus = "EXPIRED"
+	AlgoStatusCanceled AlgoStatus = "CANCELED"
 )
 
-// Symbol represents trading pairs
+// TimeInForce controls how long an order stays working
+type TimeInForce string
+
+const (
+	// TimeInForceGTC rests until filled or canceled
+	TimeInForceGTC TimeInForce = "GTC"
+	// TimeInForceIOC fills what it can immediately and cancels the remainder
+	TimeInForceIOC TimeInForce = "IOC"
+	// TimeInForceFOK fills completely and immediately or not at all
+	TimeInForceFOK TimeInForce = "FOK"
+	// TimeInForceGTD rests until filled, canceled or its expiry passes
+	TimeInForceGTD TimeInForce = "GTD"
+)
+
+// Symbol represents trading pairs, named BASE-QUOTE
 type Symbol string
 
 const (
@@ -51,6 +116,27 @@ const (
 	SymbolETHUSD Symbol = "ETH-USD"
 )
 
+// InstrumentStatus represents whether an instrument accepts new orders
+type InstrumentStatus string
+
+const (
+	InstrumentStatusTrading InstrumentStatus = "TRADING"
+	// InstrumentStatusHalted keeps the book but rejects new orders
+	InstrumentStatusHalted InstrumentStatus = "HALTED"
+)
+
+// Instrument describes a tradable pair and its trading rules
+type Instrument struct {
+	Symbol        Symbol           `json:"symbol" db:"symbol"`
+	BaseCurrency  Currency         `json:"base_currency" db:"base_currency"`
+	QuoteCurrency Currency         `json:"quote_currency" db:"quote_currency"`
+	TickSize      decimal.Decimal  `json:"tick_size" db:"tick_size"`
+	LotSize       decimal.Decimal  `json:"lot_size" db:"lot_size"`
+	MinNotional   decimal.Decimal  `json:"min_notional" db:"min_notional"`
+	Status        InstrumentStatus `json:"status" db:"status"`
+	CreatedAt     time.Time        `json:"created_at" db:"created_at"`
+}
+
 // User represents a user account
 type User struct {
 	ID           uuid.UUID `json:"id" db:"id"`
@@ -82,27 +168,85 @@ type LedgerEntry struct {
 
 // Order represents a trading order
 type Order struct {
-	ID        uuid.UUID        `json:"id" db:"id"`
-	UserID    uuid.UUID        `json:"user_id" db:"user_id"`
-	Symbol    Symbol           `json:"symbol" db:"symbol"`
-	Side      OrderSide        `json:"side" db:"side"`
-	Type      OrderType        `json:"type" db:"type"`
-	Price     *decimal.Decimal `json:"price,omitempty" db:"price"`
-	Qty       decimal.Decimal  `json:"qty" db:"qty"`
-	FilledQty decimal.Decimal  `json:"filled_qty" db:"filled_qty"`
-	Status    OrderStatus      `json:"status" db:"status"`
-	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+	ID          uuid.UUID        `json:"id" db:"id"`
+	UserID      uuid.UUID        `json:"user_id" db:"user_id"`
+	Symbol      Symbol           `json:"symbol" db:"symbol"`
+	Side        OrderSide        `json:"side" db:"side"`
+	Type        OrderType        `json:"type" db:"type"`
+	Price       *decimal.Decimal `json:"price,omitempty" db:"price"`
+	Qty         decimal.Decimal  `json:"qty" db:"qty"`
+	FilledQty   decimal.Decimal  `json:"filled_qty" db:"filled_qty"`
+	Status      OrderStatus      `json:"status" db:"status"`
+	TimeInForce TimeInForce      `json:"time_in_force" db:"time_in_force"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty" db:"expires_at"`
+	PostOnly    bool             `json:"post_only" db:"post_only"`
+	ReduceOnly  bool             `json:"reduce_only" db:"reduce_only"`
+	StopPrice   *decimal.Decimal `json:"stop_price,omitempty" db:"stop_price"`
+	TriggeredAt *time.Time       `json:"triggered_at,omitempty" db:"triggered_at"`
+	CreatedAt   time.Time        `json:"created_at" db:"created_at"`
+	// A trailing stop's StopPrice follows the quote by TrailOffset or TrailPercent
+	TrailOffset  *decimal.Decimal `json:"trail_offset,omitempty" db:"trail_offset"`
+	TrailPercent *decimal.Decimal `json:"trail_percent,omitempty" db:"trail_percent"`
+	// An iceberg shows DisplayQty at a time and hides the rest of its quantity
+	DisplayQty *decimal.Decimal `json:"display_qty,omitempty" db:"display_qty"`
+}
+
+// OrderLink ties an order to its bracket group, which is keyed by the entry order
+type OrderLink struct {
+	GroupID uuid.UUID     `json:"group_id" db:"group_id"`
+	OrderID uuid.UUID     `json:"order_id" db:"order_id"`
+	Role    OrderLinkRole `json:"role" db:"role"`
 }
 
+// AlgoOrder is a parent order that an algo slices into child orders between
+// StartAt and EndAt. ArrivalPrice is the mid when it was placed.
+type AlgoOrder struct {
+	ID           uuid.UUID        `json:"id" db:"id"`
+	UserID       uuid.UUID        `json:"user_id" db:"user_id"`
+	Symbol       Symbol           `json:"symbol" db:"symbol"`
+	Side         OrderSide        `json:"side" db:"side"`
+	Strategy     AlgoStrategy     `json:"strategy" db:"strategy"`
+	Qty          decimal.Decimal  `json:"qty" db:"qty"`
+	LimitPrice   *decimal.Decimal `json:"limit_price,omitempty" db:"limit_price"`
+	ArrivalPrice decimal.Decimal  `json:"arrival_price" db:"arrival_price"`
+	Status       AlgoStatus       `json:"status" db:"status"`
+	StartAt      time.Time        `json:"start_at" db:"start_at"`
+	EndAt        time.Time        `json:"end_at" db:"end_at"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// AlgoSlice is one scheduled step of an algo order. TargetQty is the cumulative
+// quantity the parent should have filled once the slice has run.
+type AlgoSlice struct {
+	AlgoID      uuid.UUID       `json:"-" db:"algo_id"`
+	Slice       int             `json:"slice" db:"slice"`
+	DueAt       time.Time       `json:"due_at" db:"due_at"`
+	TargetQty   decimal.Decimal `json:"target_qty" db:"target_qty"`
+	OrderID     *uuid.UUID      `json:"order_id,omitempty" db:"order_id"`
+	SubmittedAt *time.Time      `json:"submitted_at,omitempty" db:"submitted_at"`
+	Error       *string         `json:"error,omitempty" db:"error"`
+}
+
+// IdempotencyStatus represents the lifecycle of an idempotency key
+type IdempotencyStatus string
+
+const (
+	IdempotencyStatusInProgress IdempotencyStatus = "IN_PROGRESS"
+	IdempotencyStatusCompleted  IdempotencyStatus = "COMPLETED"
+)
+
 // IdempotencyKey represents an idempotency key for request deduplication
 type IdempotencyKey struct {
-	ID                 uuid.UUID `json:"id" db:"id"`
-	UserID             uuid.UUID `json:"user_id" db:"user_id"`
-	IdemKey            string    `json:"idem_key" db:"idem_key"`
-	RequestFingerprint string    `json:"request_fingerprint" db:"request_fingerprint"`
-	ResponseCode       int       `json:"response_code" db:"response_code"`
-	ResponseBody       []byte    `json:"response_body" db:"response_body"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	ID                 uuid.UUID         `json:"id" db:"id"`
+	UserID             uuid.UUID         `json:"user_id" db:"user_id"`
+	IdemKey            string            `json:"idem_key" db:"idem_key"`
+	RequestFingerprint string            `json:"request_fingerprint" db:"request_fingerprint"`
+	Status             IdempotencyStatus `json:"status" db:"status"`
+	ResponseCode       int               `json:"response_code" db:"response_code"`
+	ResponseBody       []byte            `json:"response_body" db:"response_body"`
+	CreatedAt          time.Time         `json:"created_at" db:"created_at"`
+	ExpiresAt          time.Time         `json:"expires_at" db:"expires_at"`
 }
 
 // OutboxEvent represents an event to be published
@@ -122,23 +266,63 @@ type Quote struct {
 	TS     time.Time       `json:"ts"`
 }
 
+// Liquidity tells whether a fill added liquidity to the book or took it
+type Liquidity string
+
+const (
+	LiquidityMaker Liquidity = "MAKER"
+	LiquidityTaker Liquidity = "TAKER"
+)
+
 // Trade represents a completed trade
 type Trade struct {
-	ID        uuid.UUID       `json:"id"`
-	Symbol    Symbol          `json:"symbol"`
-	Side      OrderSide       `json:"side"`
-	Price     decimal.Decimal `json:"price"`
-	Qty       decimal.Decimal `json:"qty"`
-	TakerID   uuid.UUID       `json:"taker_id"`
-	MakerID   uuid.UUID       `json:"maker_id"`
-	CreatedAt time.Time       `json:"created_at"`
+	ID           uuid.UUID       `json:"id"`
+	Symbol       Symbol          `json:"symbol"`
+	Side         OrderSide       `json:"side"`
+	Price        decimal.Decimal `json:"price"`
+	Qty          decimal.Decimal `json:"qty"`
+	TakerID      uuid.UUID       `json:"taker_id"`
+	MakerID      uuid.UUID       `json:"maker_id"`
+	TakerOrderID uuid.UUID       `json:"taker_order_id"`
+	MakerOrderID uuid.UUID       `json:"maker_order_id"`
+	TakerFee     decimal.Decimal `json:"taker_fee"`
+	MakerFee     decimal.Decimal `json:"maker_fee"`
+	// Each side pays its fee in the currency it receives
+	TakerFeeCurrency Currency `json:"taker_fee_currency"`
+	MakerFeeCurrency Currency `json:"maker_fee_currency"`
+	// NotionalUSD is the trade's value in USD at execution, used for fee tier volume
+	NotionalUSD decimal.Decimal `json:"notional_usd"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// FeeTier is the maker and taker fee, in basis points, charged from a 30-day
+// traded volume in USD upwards
+type FeeTier struct {
+	MinVolume decimal.Decimal `json:"min_volume" db:"min_volume"`
+	MakerBps  decimal.Decimal `json:"maker_bps" db:"maker_bps"`
+	TakerBps  decimal.Decimal `json:"taker_bps" db:"taker_bps"`
+}
+
+// Fill represents one side of a trade from the point of view of its order
+type Fill struct {
+	TradeID     uuid.UUID       `json:"trade_id" db:"id"`
+	OrderID     uuid.UUID       `json:"order_id" db:"order_id"`
+	Symbol      Symbol          `json:"symbol" db:"symbol"`
+	Side        OrderSide       `json:"side" db:"side"`
+	Price       decimal.Decimal `json:"price" db:"price"`
+	Qty         decimal.Decimal `json:"qty" db:"qty"`
+	Fee         decimal.Decimal `json:"fee" db:"fee"`
+	FeeCurrency Currency        `json:"fee_currency" db:"fee_currency"`
+	Liquidity   Liquidity       `json:"liquidity" db:"liquidity"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
 }
 
 // Portfolio represents a user's portfolio
 type Portfolio struct {
-	Balances  []AccountBalance `json:"balances"`
-	Positions []Position       `json:"positions"`
-	PnL       PnL              `json:"pnl"`
+	Balances    []AccountBalance `json:"balances"`
+	Positions   []Position       `json:"positions"`
+	PnL         PnL              `json:"pnl"`
+	TotalEquity decimal.Decimal  `json:"total_equity"`
 }
 
 // AccountBalance represents a balance for a specific currency
@@ -151,9 +335,13 @@ type AccountBalance struct {
 
 // Position represents a trading position
 type Position struct {
-	Symbol        Symbol          `json:"symbol"`
+	Symbol Symbol `json:"symbol"`
+	// Prices and PnL are in the symbol's quote currency
+	QuoteCurrency Currency        `json:"quote_currency"`
 	Qty           decimal.Decimal `json:"qty"`
 	AvgPrice      decimal.Decimal `json:"avg_price"`
+	MarkPrice     decimal.Decimal `json:"mark_price"`
+	RealizedPnL   decimal.Decimal `json:"realized_pnl"`
 	UnrealizedPnL decimal.Decimal `json:"unrealized_pnl"`
 }
 
@@ -0,0 +1,455 @@
+package orders
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"microcoin/internal/instruments"
+	"microcoin/internal/limitbook"
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// A bracket is a buy entry order with a take-profit limit sell and/or a stop-loss
+// stop sell attached. The children are created PENDING with the entry and go live
+// once the entry stops working, sized to what it filled and sharing a single hold
+// on that quantity. From then on they are one-cancels-the-other: a leg that fills,
+// triggers or closes cancels its open sibling, which leaves the shared hold alone.
+
+// validateBracket validates the take-profit and stop-loss legs of an entry order
+func validateBracket(req *models.CreateOrderRequest) error {
+	// Children sell what the entry bought, so only buys can carry them
+	if req.Side != models.OrderSideBuy {
+		return fmt.Errorf("only buy orders can carry take-profit or stop-loss orders")
+	}
+	if req.Type != models.OrderTypeLimit && req.Type != models.OrderTypeMarket {
+		return fmt.Errorf("only limit and market orders can carry take-profit or stop-loss orders")
+	}
+
+	if tp := req.TakeProfit; tp != nil {
+		if tp.Price == nil || tp.Price.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("take-profit orders must have a positive price")
+		}
+		if tp.StopPrice != nil {
+			return fmt.Errorf("take-profit orders cannot have a stop_price")
+		}
+		if req.Price != nil && tp.Price.LessThanOrEqual(*req.Price) {
+			return fmt.Errorf("take-profit price must be above the entry price")
+		}
+	}
+
+	if sl := req.StopLoss; sl != nil {
+		if sl.StopPrice == nil || sl.StopPrice.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("stop-loss orders must have a positive stop_price")
+		}
+		if sl.Price != nil && sl.Price.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("stop-loss limit price must be positive")
+		}
+		if req.Price != nil && sl.StopPrice.GreaterThanOrEqual(*req.Price) {
+			return fmt.Errorf("stop-loss stop_price must be below the entry price")
+		}
+	}
+
+	if req.TakeProfit != nil && req.StopLoss != nil && req.TakeProfit.Price.LessThanOrEqual(*req.StopLoss.StopPrice) {
+		return fmt.Errorf("take-profit price must be above the stop-loss stop_price")
+	}
+
+	return nil
+}
+
+// bracketChildren builds the pending take-profit and stop-loss children of an entry order
+func bracketChildren(parent *models.Order, req *models.CreateOrderRequest) []*models.Order {
+	newChild := func(orderType models.OrderType, price, stopPrice *decimal.Decimal) *models.Order {
+		return &models.Order{
+			ID:          uuid.New(),
+			UserID:      parent.UserID,
+			Symbol:      parent.Symbol,
+			Side:        models.OrderSideSell,
+			Type:        orderType,
+			Price:       price,
+			Qty:         parent.Qty,
+			FilledQty:   decimal.Zero,
+			Status:      models.OrderStatusPending,
+			TimeInForce: models.TimeInForceGTC,
+			StopPrice:   stopPrice,
+			CreatedAt:   parent.CreatedAt,
+		}
+	}
+
+	var children []*models.Order
+	if tp := req.TakeProfit; tp != nil {
+		children = append(children, newChild(models.OrderTypeLimit, tp.Price, nil))
+	}
+	if sl := req.StopLoss; sl != nil {
+		orderType := models.OrderTypeStopMarket
+		if sl.Price != nil {
+			orderType = models.OrderTypeStopLimit
+		}
+		children = append(children, newChild(orderType, sl.Price, sl.StopPrice))
+	}
+
+	return children
+}
+
+// createGroupTx persists an entry order's children and links the group within the
+// placement transaction. The group is keyed by the entry order.
+func (s *Service) createGroupTx(tx *sql.Tx, parent *models.Order, children []*models.Order) ([]models.OrderLink, error) {
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	group := []models.OrderLink{{GroupID: parent.ID, OrderID: parent.ID, Role: models.OrderLinkRoleParent}}
+	for _, child := range children {
+		if err := s.orderRepo.CreateOrder(tx, child); err != nil {
+			return nil, fmt.Errorf("failed to create order: %w", err)
+		}
+
+		role := models.OrderLinkRoleTakeProfit
+		if isStopOrder(child.Type) {
+			role = models.OrderLinkRoleStopLoss
+		}
+		group = append(group, models.OrderLink{GroupID: parent.ID, OrderID: child.ID, Role: role})
+	}
+
+	for i := range group {
+		if err := s.linkRepo.CreateLink(tx, &group[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return group, nil
+}
+
+// GetOrderGroup retrieves the bracket group an order belongs to, or nil if it has none
+func (s *Service) GetOrderGroup(orderID uuid.UUID) ([]models.OrderLink, error) {
+	link, err := s.linkRepo.GetLink(orderID)
+	if err != nil || link == nil {
+		return nil, err
+	}
+
+	return s.linkRepo.GetGroup(link.GroupID)
+}
+
+// settleGroups settles the bracket groups of any of the orders. Callers must hold s.mutex.
+func (s *Service) settleGroups(orderIDs []uuid.UUID) {
+	groupIDs, err := s.linkRepo.GetGroupIDs(orderIDs)
+	if err != nil {
+		log.Printf("Failed to look up order groups: %v", err)
+		return
+	}
+
+	for _, groupID := range groupIDs {
+		if err := s.settleGroup(groupID); err != nil {
+			log.Printf("Failed to settle order group %s: %v", groupID, err)
+		}
+	}
+}
+
+// settleGroup brings a bracket group in line with the state of its orders: pending
+// children go live or are canceled once the entry stops working, and open OCO legs
+// are canceled once a sibling has filled, triggered or closed. Settling a settled
+// group changes nothing. Callers must hold s.mutex.
+func (s *Service) settleGroup(groupID uuid.UUID) error {
+	links, err := s.linkRepo.GetGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	var parent *models.Order
+	var children []*models.Order
+	for _, link := range links {
+		order, err := s.orderRepo.GetOrderByID(link.OrderID)
+		if err != nil {
+			return err
+		}
+		if link.Role == models.OrderLinkRoleParent {
+			parent = order
+		} else {
+			children = append(children, order)
+		}
+	}
+
+	if parent == nil {
+		return fmt.Errorf("order group %s has no entry order", groupID)
+	}
+	if isOpenStatus(parent.Status) {
+		return nil
+	}
+
+	var pending []*models.Order
+	closedLeg := false
+	for _, child := range children {
+		if child.Status == models.OrderStatusPending {
+			pending = append(pending, child)
+		} else if !isOpenStatus(child.Status) {
+			closedLeg = true
+		}
+	}
+
+	if len(pending) > 0 {
+		// An entry that never filled protects nothing, and a leg canceled while
+		// pending takes its sibling with it
+		if closedLeg || parent.FilledQty.IsZero() {
+			for _, child := range pending {
+				if _, err := s.closeOrder(child.ID, models.OrderStatusCanceled, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		trades, err := s.activateChildren(parent, pending)
+		if err != nil {
+			return err
+		}
+
+		// A take-profit that filled on activation cancels its stop-loss through
+		// this group, and may have finished other groups on the maker side
+		s.settleGroups(tradeOrderIDs(groupID, trades))
+		return nil
+	}
+
+	engaged := false
+	for _, child := range children {
+		if legEngaged(child) {
+			engaged = true
+		}
+	}
+	if !engaged {
+		return nil
+	}
+
+	for _, child := range children {
+		if isOpenStatus(child.Status) && !legEngaged(child) {
+			if _, err := s.closeOrder(child.ID, models.OrderStatusCanceled, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// activateChildren puts an entry's pending children live for the quantity it filled
+// net of fees, in whole lots, holding that quantity once for all of them. A take-profit
+// that crosses the book matches right away; a stop-loss waits in the trigger book.
+// Children too small to trade under the instrument's rules are canceled instead,
+// holding nothing. Callers must hold s.mutex.
+func (s *Service) activateChildren(parent *models.Order, children []*models.Order) ([]*models.Trade, error) {
+	qty, err := s.childQty(parent, children)
+	if err != nil {
+		return nil, err
+	}
+	if !qty.IsPositive() {
+		for _, child := range children {
+			if _, err := s.closeOrder(child.ID, models.OrderStatusCanceled, false); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	bookOrders := make([]*limitbook.Order, len(children))
+	trades, err := s.activateChildrenTx(parent, children, qty, bookOrders)
+	if err != nil {
+		for _, bookOrder := range bookOrders {
+			if bookOrder != nil && bookOrder.FilledQty.GreaterThan(decimal.Zero) {
+				s.reloadBook(parent.Symbol)
+				break
+			}
+		}
+
+		// Children that cannot go live would otherwise wait forever
+		for _, child := range children {
+			if _, rejectErr := s.closeOrder(child.ID, models.OrderStatusRejected, false); rejectErr != nil {
+				log.Printf("Failed to reject bracket order %s: %v", child.ID, rejectErr)
+			}
+		}
+		return nil, err
+	}
+
+	for i, child := range children {
+		switch {
+		case isUntriggeredStop(child):
+			s.triggerBooks[child.Symbol].AddStop(bookOrders[i])
+		case isOpenStatus(child.Status):
+			s.orderBooks[child.Symbol].AddOrder(bookOrders[i])
+		}
+	}
+
+	return trades, nil
+}
+
+// activateChildrenTx holds the children's shared quantity, moves them live and
+// matches the take-profit in one transaction. bookOrders receives each child's
+// book order.
+func (s *Service) activateChildrenTx(parent *models.Order, children []*models.Order, qty decimal.Decimal, bookOrders []*limitbook.Order) ([]*models.Trade, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.holdFunds(tx, parent.UserID, parent.Symbol, models.OrderSideSell, qty); err != nil {
+		return nil, err
+	}
+
+	var trades []*models.Trade
+	for i, child := range children {
+		child.Qty = qty
+		child.Status = models.OrderStatusNew
+		if err := s.orderRepo.ActivateOrder(tx, child); err != nil {
+			return nil, err
+		}
+
+		bookOrders[i] = s.convertToBookOrder(child)
+		if child.Type != models.OrderTypeLimit {
+			continue
+		}
+
+		childTrades, err := s.executeOrderTx(tx, child, bookOrders[i], s.orderBooks[child.Symbol], *child.Price)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, childTrades...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return trades, nil
+}
+
+// childQty returns the quantity an entry's children trade: what the entry received,
+// floored to whole lots. It is zero when that leaves nothing, or when any child
+// would be worth less than the minimum notional at its price (stop-market legs
+// at their stop price).
+func (s *Service) childQty(parent *models.Order, children []*models.Order) (decimal.Decimal, error) {
+	instrument, err := s.instruments.Get(parent.Symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	received, err := s.receivedQty(parent)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	qty := received.Div(instrument.LotSize).Floor().Mul(instrument.LotSize)
+	if !qty.IsPositive() {
+		return decimal.Zero, nil
+	}
+
+	for _, child := range children {
+		price := child.Price
+		if price == nil {
+			price = child.StopPrice
+		}
+		if price != nil && instruments.CheckNotional(instrument, *price, qty) != nil {
+			return decimal.Zero, nil
+		}
+	}
+
+	return qty, nil
+}
+
+// receivedQty returns the base quantity a buy order's fills delivered, net of the
+// fees paid out of it
+func (s *Service) receivedQty(order *models.Order) (decimal.Decimal, error) {
+	baseCurrency, err := s.holdCurrency(order.Symbol, models.OrderSideSell)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	fills, err := s.tradeRepo.GetFillsByOrderID(order.ID)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	qty := order.FilledQty
+	for _, fill := range fills {
+		if fill.FeeCurrency == baseCurrency {
+			qty = qty.Sub(fill.Fee)
+		}
+	}
+
+	return qty, nil
+}
+
+// closeSiblings cancels the open OCO siblings of a bracket child, leaving the shared
+// hold to the child. Callers must hold s.mutex.
+func (s *Service) closeSiblings(orderID uuid.UUID) error {
+	link, err := s.linkRepo.GetLink(orderID)
+	if err != nil || link == nil || link.Role == models.OrderLinkRoleParent {
+		return err
+	}
+
+	links, err := s.linkRepo.GetGroup(link.GroupID)
+	if err != nil {
+		return err
+	}
+
+	for _, sibling := range links {
+		if sibling.Role == models.OrderLinkRoleParent || sibling.OrderID == orderID {
+			continue
+		}
+
+		order, err := s.orderRepo.GetOrderByID(sibling.OrderID)
+		if err != nil {
+			return err
+		}
+		if !isOpenStatus(order.Status) {
+			continue
+		}
+
+		if _, err := s.closeOrder(order.ID, models.OrderStatusCanceled, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resumeGroups settles every group with a pending or open child, finishing work
+// left undone when the process stopped between an order and its group settling
+func (s *Service) resumeGroups() {
+	groupIDs, err := s.linkRepo.GetOpenGroupIDs()
+	if err != nil {
+		log.Printf("Failed to load open order groups: %v", err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, groupID := range groupIDs {
+		if err := s.settleGroup(groupID); err != nil {
+			log.Printf("Failed to settle order group %s: %v", groupID, err)
+		}
+	}
+}
+
+// legEngaged reports whether an active bracket child has filled, triggered or closed
+func legEngaged(order *models.Order) bool {
+	return order.FilledQty.GreaterThan(decimal.Zero) || order.TriggeredAt != nil || !isOpenStatus(order.Status)
+}
+
+// isOpenStatus reports whether an order in status is still working
+func isOpenStatus(status models.OrderStatus) bool {
+	return status == models.OrderStatusNew || status == models.OrderStatusPartiallyFilled
+}
+
+// tradeOrderIDs returns an order's ID with the IDs of every order on either side of its trades
+func tradeOrderIDs(orderID uuid.UUID, trades []*models.Trade) []uuid.UUID {
+	orderIDs := []uuid.UUID{orderID}
+	for _, trade := range trades {
+		orderIDs = append(orderIDs, trade.TakerOrderID)
+		if trade.MakerOrderID != uuid.Nil {
+			orderIDs = append(orderIDs, trade.MakerOrderID)
+		}
+	}
+	return orderIDs
+}
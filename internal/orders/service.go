@@ -1,11 +1,19 @@
 package orders
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"microcoin/internal/database"
+	"microcoin/internal/fees"
+	"microcoin/internal/instruments"
 	"microcoin/internal/ledger"
 	"microcoin/internal/limitbook"
 	"microcoin/internal/models"
@@ -15,14 +23,56 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+var (
+	// ErrOrderNotFound is returned when an order does not exist
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderNotOwned is returned when a user acts on another user's order
+	ErrOrderNotOwned = errors.New("order belongs to another user")
+	// ErrOrderNotOpen is returned when an order is no longer resting in the book
+	ErrOrderNotOpen = errors.New("order is not open")
+	// ErrInvalidAmendment is returned when an amendment request cannot be applied
+	ErrInvalidAmendment = errors.New("invalid amendment")
+	// ErrPostOnlyWouldCross is returned when a post-only order would take liquidity
+	ErrPostOnlyWouldCross = errors.New("post-only order would cross the book")
+	// ErrReduceOnlyExceedsPosition is returned when a reduce-only sell is larger than
+	// the position left after the user's other open sells
+	ErrReduceOnlyExceedsPosition = errors.New("reduce-only order exceeds position")
+	// ErrStopWouldTrigger is returned when a stop order's stop price is already
+	// crossed by the current quote
+	ErrStopWouldTrigger = errors.New("stop price would trigger immediately")
+	// ErrInstrumentNotTrading is returned when an order is placed on a halted instrument
+	ErrInstrumentNotTrading = errors.New("instrument is not trading")
+	// ErrNoQuote is returned when a market order cannot be priced
+	ErrNoQuote = errors.New("no quote available for market order")
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	// DefaultOrdersPageSize is the page size used when none is requested
+	DefaultOrdersPageSize = 50
+	// MaxOrdersPageSize caps the page size of order history listings
+	MaxOrdersPageSize = 200
+	// DefaultBookDepth is how many price levels per side a book snapshot shows by default
+	DefaultBookDepth = 20
+	// MaxBookDepth caps how many price levels per side a book snapshot shows
+	MaxBookDepth = 500
+)
+
 // Service handles order business logic
 type Service struct {
 	db            *sql.DB
 	orderRepo     *database.OrderRepository
+	tradeRepo     *database.TradeRepository
+	linkRepo      *database.OrderLinkRepository
 	accountRepo   *database.AccountRepository
 	ledgerService *ledger.Service
+	instruments   *instruments.Registry
+	feeSchedule   *fees.Schedule
 	quotesService *quotes.Service
 	orderBooks    map[models.Symbol]*limitbook.OrderBook
+	triggerBooks  map[models.Symbol]*limitbook.TriggerBook
+	mutex         sync.Mutex
 }
 
 // NewService creates a new order service
@@ -30,35 +80,129 @@ func NewService(db *sql.DB, quotesService *quotes.Service) *Service {
 	service := &Service{
 		db:            db,
 		orderRepo:     database.NewOrderRepository(db),
+		tradeRepo:     database.NewTradeRepository(db),
+		linkRepo:      database.NewOrderLinkRepository(db),
 		accountRepo:   database.NewAccountRepository(db),
 		ledgerService: ledger.NewService(db),
+		instruments:   loadInstruments(db),
+		feeSchedule:   loadFeeSchedule(db),
 		quotesService: quotesService,
 		orderBooks:    make(map[models.Symbol]*limitbook.OrderBook),
+		triggerBooks:  make(map[models.Symbol]*limitbook.TriggerBook),
 	}
 
-	// Initialize order books
-	service.orderBooks[models.SymbolBTCUSD] = limitbook.NewOrderBook(models.SymbolBTCUSD)
-	service.orderBooks[models.SymbolETHUSD] = limitbook.NewOrderBook(models.SymbolETHUSD)
+	// Initialize a book per listed instrument
+	for _, symbol := range service.instruments.Symbols() {
+		service.orderBooks[symbol] = limitbook.NewOrderBook(symbol)
+		service.triggerBooks[symbol] = limitbook.NewTriggerBook(symbol)
+	}
 
 	// Load existing orders into order books
 	service.loadOrdersIntoBooks()
 
+	// Finish bracket groups left unsettled when the process last stopped
+	service.resumeGroups()
+
 	return service
 }
 
+// loadInstruments reads the instrument registry; without it nothing can trade
+func loadInstruments(db *sql.DB) *instruments.Registry {
+	registry, err := instruments.Load(db)
+	if err != nil {
+		log.Printf("Failed to load instruments: %v", err)
+		return instruments.NewRegistry(nil)
+	}
+
+	return registry
+}
+
+// Instruments returns the registry of instruments the service trades
+func (s *Service) Instruments() *instruments.Registry {
+	return s.instruments
+}
+
+// BookSnapshot returns the visible depth of a symbol's book, up to depth price
+// levels a side
+func (s *Service) BookSnapshot(symbol models.Symbol, depth int) (*limitbook.Snapshot, error) {
+	if _, err := s.instruments.Get(symbol); err != nil {
+		return nil, err
+	}
+
+	return s.orderBooks[symbol].Snapshot(depth), nil
+}
+
+// SubscribeBook returns a full snapshot of a symbol's book and a channel of the
+// incremental updates that follow it
+func (s *Service) SubscribeBook(symbol models.Symbol) (<-chan *limitbook.BookUpdate, *limitbook.Snapshot, error) {
+	if _, err := s.instruments.Get(symbol); err != nil {
+		return nil, nil, err
+	}
+
+	ch, snapshot := s.orderBooks[symbol].Subscribe()
+	return ch, snapshot, nil
+}
+
+// UnsubscribeBook stops the updates of a channel returned by SubscribeBook
+func (s *Service) UnsubscribeBook(symbol models.Symbol, ch <-chan *limitbook.BookUpdate) {
+	if orderBook, ok := s.orderBooks[symbol]; ok {
+		orderBook.Unsubscribe(ch)
+	}
+}
+
+// loadFeeSchedule reads the fee schedule, falling back to the default when it
+// cannot be loaded
+func loadFeeSchedule(db *sql.DB) *fees.Schedule {
+	tiers, err := database.NewFeeRepository(db).GetFeeTiers()
+	if err != nil {
+		log.Printf("Failed to load fee schedule, using default: %v", err)
+		return fees.DefaultSchedule()
+	}
+
+	schedule, err := fees.NewSchedule(tiers)
+	if err != nil {
+		log.Printf("Invalid fee schedule, using default: %v", err)
+		return fees.DefaultSchedule()
+	}
+
+	return schedule
+}
+
+// RecordFunc persists side effects of an order placement inside its transaction
+type RecordFunc func(tx *sql.Tx, resp *models.CreateOrderResponse) error
+
 // CreateOrder creates a new order
 func (s *Service) CreateOrder(userID uuid.UUID, req *models.CreateOrderRequest) (*models.CreateOrderResponse, error) {
+	return s.CreateOrderWithRecord(userID, req, nil)
+}
+
+// CreateOrderWithRecord creates a new order and, when record is set, calls it with the
+// response before the placement commits so both take effect atomically
+func (s *Service) CreateOrderWithRecord(userID uuid.UUID, req *models.CreateOrderRequest, record RecordFunc) (*models.CreateOrderResponse, error) {
+	if req.TimeInForce == "" {
+		req.TimeInForce = models.TimeInForceGTC
+	}
+
 	// Validate request
 	if err := s.validateOrderRequest(req); err != nil {
 		return nil, err
 	}
+	instrument, err := s.instruments.Get(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get current quote for market orders
+	// Market orders are priced off the current quote, which the liquidity provider
+	// always trades at, so they cannot be accepted without one
 	var fillPrice *decimal.Decimal
 	if req.Type == models.OrderTypeMarket {
+		if s.quotesService == nil {
+			return nil, ErrNoQuote
+		}
+
 		quote, err := s.quotesService.GetQuote(req.Symbol)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get quote: %w", err)
+			return nil, fmt.Errorf("%w: %v", ErrNoQuote, err)
 		}
 
 		if req.Side == models.OrderSideBuy {
@@ -66,6 +210,42 @@ func (s *Service) CreateOrder(userID uuid.UUID, req *models.CreateOrderRequest)
 		} else {
 			fillPrice = &quote.Bid
 		}
+
+		// Market orders are valued at the quote they would fill at
+		if err := instruments.CheckNotional(instrument, *fillPrice, req.Qty); err != nil {
+			return nil, err
+		}
+	}
+
+	// Trailing stops start the trail from the current quote
+	if req.Type == models.OrderTypeTrailingStop {
+		if s.quotesService == nil {
+			return nil, ErrNoQuote
+		}
+
+		quote, err := s.quotesService.GetQuote(req.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNoQuote, err)
+		}
+
+		stopPrice := limitbook.TrailingStopPrice(req.Side, req.TrailOffset, req.TrailPercent, quote.Bid, quote.Ask, instrument.TickSize)
+		if !stopPrice.IsPositive() {
+			return nil, fmt.Errorf("trail leaves no positive stop price below the bid %s", quote.Bid)
+		}
+		req.StopPrice = &stopPrice
+
+		// Trailing stops are valued at their starting stop price
+		if err := instruments.CheckNotional(instrument, stopPrice, req.Qty); err != nil {
+			return nil, err
+		}
+	}
+
+	// A stop the quote has already crossed would go live on the next tick anyway
+	if isStopOrder(req.Type) && s.quotesService != nil {
+		quote, err := s.quotesService.GetQuote(req.Symbol)
+		if err == nil && limitbook.StopTriggered(req.Side, *req.StopPrice, quote.Bid, quote.Ask) {
+			return nil, ErrStopWouldTrigger
+		}
 	}
 
 	// Calculate required funds
@@ -74,285 +254,1459 @@ func (s *Service) CreateOrder(userID uuid.UUID, req *models.CreateOrderRequest)
 		return nil, err
 	}
 
-	// Check and hold funds
-	if err := s.holdFunds(userID, req, requiredAmount); err != nil {
-		return nil, err
+	// Buy holds are sized at this price; fills below it release the difference.
+	// Stop-market and trailing stop buys hold at their stop price until triggered.
+	holdPrice := fillPrice
+	if holdPrice == nil {
+		holdPrice = req.Price
+	}
+	if holdPrice == nil {
+		holdPrice = req.StopPrice
 	}
 
 	// Create order
 	order := &models.Order{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Symbol:    req.Symbol,
-		Side:      req.Side,
-		Type:      req.Type,
-		Price:     req.Price,
-		Qty:       req.Qty,
-		FilledQty: decimal.Zero,
-		Status:    models.OrderStatusNew,
-		CreatedAt: time.Now(),
+		ID:           uuid.New(),
+		UserID:       userID,
+		Symbol:       req.Symbol,
+		Side:         req.Side,
+		Type:         req.Type,
+		Price:        req.Price,
+		Qty:          req.Qty,
+		FilledQty:    decimal.Zero,
+		Status:       models.OrderStatusNew,
+		TimeInForce:  req.TimeInForce,
+		ExpiresAt:    req.ExpiresAt,
+		PostOnly:     req.PostOnly,
+		ReduceOnly:   req.ReduceOnly,
+		StopPrice:    req.StopPrice,
+		TrailOffset:  req.TrailOffset,
+		TrailPercent: req.TrailPercent,
+		DisplayQty:   req.DisplayQty,
+		CreatedAt:    time.Now(),
+	}
+	children := bracketChildren(order, req)
+
+	// Placement mutates the in-memory book, so serialize it with other book writers
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	orderBook := s.orderBooks[req.Symbol]
+	bookOrder := s.convertToBookOrder(order)
+	if order.Type == models.OrderTypeMarket {
+		// Book liquidity is only taken at or better than the quote, which also
+		// keeps every fill within the hold sized at the quote
+		bookOrder.Price = fillPrice
+	}
+
+	// A post-only order that would take liquidity is rejected, or moved one tick
+	// behind the opposite best so it rests instead
+	if order.PostOnly && orderBook.WouldCross(bookOrder) {
+		if !req.PostOnlyReprice {
+			return nil, ErrPostOnlyWouldCross
+		}
+
+		price, err := repricePostOnly(orderBook, order.Side, instrument.TickSize)
+		if err != nil {
+			return nil, err
+		}
+		order.Price = &price
+		bookOrder.Price = &price
+		holdPrice = &price
+		requiredAmount = restingHold(order.Side, price, order.Qty)
+	}
+
+	if order.ReduceOnly {
+		if err := s.checkReduceOnly(order.UserID, order.Symbol, order.Qty, uuid.Nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if isStopOrder(order.Type) {
+		return s.placeStopOrderTx(order, requiredAmount, record)
+	}
+
+	resp, trades, err := s.placeOrderTx(order, children, bookOrder, orderBook, *holdPrice, requiredAmount, record)
+	if err != nil {
+		// Matching may already have filled resting orders in memory; rebuild the
+		// book from the last committed state so it matches the rolled back database
+		if bookOrder.FilledQty.GreaterThan(decimal.Zero) {
+			s.reloadBook(req.Symbol)
+		}
+		return nil, err
+	}
+
+	// Add to order book if not fully filled; market orders never rest
+	if order.Type == models.OrderTypeLimit && (order.Status == models.OrderStatusNew || order.Status == models.OrderStatusPartiallyFilled) {
+		orderBook.AddOrder(bookOrder)
+	}
+
+	// Fills may finish a bracket entry or an OCO leg, on either side of a trade
+	s.settleGroups(tradeOrderIDs(order.ID, trades))
+
+	return resp, nil
+}
+
+// placeOrderTx holds funds, persists the order with any bracket children and settles
+// every fill in one transaction
+func (s *Service) placeOrderTx(order *models.Order, children []*models.Order, bookOrder *limitbook.Order, orderBook *limitbook.OrderBook, holdPrice, requiredAmount decimal.Decimal, record RecordFunc) (*models.CreateOrderResponse, []*models.Trade, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A fill-or-kill limit that the book cannot fill in full is killed before
+	// anything is held or filled; market orders always fill through the provider
+	if order.TimeInForce == models.TimeInForceFOK && order.Type == models.OrderTypeLimit &&
+		orderBook.FillableQty(bookOrder).LessThan(order.Qty) {
+		order.Status = models.OrderStatusCanceled
+		if err := s.orderRepo.CreateOrder(tx, order); err != nil {
+			return nil, nil, fmt.Errorf("failed to create order: %w", err)
+		}
+		group, err := s.createGroupTx(tx, order, children)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := s.commitPlacement(tx, order, nil, group, record)
+		return resp, nil, err
+	}
+
+	// Check and hold funds
+	if err := s.holdFunds(tx, order.UserID, order.Symbol, order.Side, requiredAmount); err != nil {
+		return nil, nil, err
 	}
 
 	// Save order to database
-	if err := s.orderRepo.CreateOrder(order); err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+	if err := s.orderRepo.CreateOrder(tx, order); err != nil {
+		return nil, nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
-	// Convert to limitbook order
-	bookOrder := s.convertToBookOrder(order)
+	trades, err := s.executeOrderTx(tx, order, bookOrder, orderBook, holdPrice)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	group, err := s.createGroupTx(tx, order, children)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.commitPlacement(tx, order, trades, group, record)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, trades, nil
+}
 
+// executeOrderTx matches a live order against the book, settles its fills and
+// persists its resulting state. Holds must already be in place.
+func (s *Service) executeOrderTx(tx *sql.Tx, order *models.Order, bookOrder *limitbook.Order, orderBook *limitbook.OrderBook, holdPrice decimal.Decimal) ([]*models.Trade, error) {
 	// Try to match the order
-	orderBook := s.orderBooks[req.Symbol]
 	trades := orderBook.MatchOrder(bookOrder)
 
+	// Whatever the book could not fill of a market order goes to the liquidity provider
+	if liveType(order.Type) == models.OrderTypeMarket {
+		if trade := liquidityProviderTrade(bookOrder, holdPrice); trade != nil {
+			trades = append(trades, trade)
+		}
+	}
+
 	// Process trades
-	var totalFillQty decimal.Decimal
-	var totalFillValue decimal.Decimal
 	for _, trade := range trades {
-		if err := s.processTrade(trade); err != nil {
-			// Log error but continue processing other trades
-			fmt.Printf("Failed to process trade: %v\n", err)
-			continue
+		if err := s.processTrade(tx, trade, holdPrice); err != nil {
+			return nil, fmt.Errorf("failed to process trade: %w", err)
 		}
-		totalFillQty = totalFillQty.Add(trade.Qty)
-		totalFillValue = totalFillValue.Add(trade.Price.Mul(trade.Qty))
 	}
 
 	// Update order status
-	order.FilledQty = totalFillQty
+	order.FilledQty = bookOrder.FilledQty
 	if order.FilledQty.Equal(order.Qty) {
 		order.Status = models.OrderStatusFilled
 	} else if order.FilledQty.GreaterThan(decimal.Zero) {
 		order.Status = models.OrderStatusPartiallyFilled
 	}
 
-	// Update order in database
-	tx, err := s.db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	// Immediate-or-cancel orders give up whatever did not fill and its hold
+	remainingQty := order.Qty.Sub(order.FilledQty)
+	if order.TimeInForce == models.TimeInForceIOC && remainingQty.GreaterThan(decimal.Zero) {
+		currency, err := s.holdCurrency(order.Symbol, order.Side)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.ledgerService.ReleaseHoldTx(tx, order.UserID, currency, restingHold(order.Side, holdPrice, remainingQty)); err != nil {
+			return nil, fmt.Errorf("failed to release hold: %w", err)
+		}
+		order.Status = models.OrderStatusCanceled
 	}
-	defer tx.Rollback()
 
+	// Update order in database
 	if err := s.orderRepo.UpdateOrder(tx, order); err != nil {
 		return nil, fmt.Errorf("failed to update order: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	return trades, nil
+}
+
+// placeStopOrderTx holds funds for a stop order, persists it untriggered and parks
+// it in the trigger book
+func (s *Service) placeStopOrderTx(order *models.Order, requiredAmount decimal.Decimal, record RecordFunc) (*models.CreateOrderResponse, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Add to order book if not fully filled
-	if order.Status == models.OrderStatusNew || order.Status == models.OrderStatusPartiallyFilled {
-		orderBook.AddOrder(bookOrder)
+	if err := s.holdFunds(tx, order.UserID, order.Symbol, order.Side, requiredAmount); err != nil {
+		return nil, err
 	}
 
-	// Calculate average fill price
-	var avgFillPrice *decimal.Decimal
-	if totalFillQty.GreaterThan(decimal.Zero) {
-		avg := totalFillValue.Div(totalFillQty)
-		avgFillPrice = &avg
+	if err := s.orderRepo.CreateOrder(tx, order); err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
-	return &models.CreateOrderResponse{
-		OrderID:      order.ID.String(),
-		Status:       order.Status,
-		FilledQty:    totalFillQty,
-		AvgFillPrice: avgFillPrice,
-	}, nil
-}
+	resp, err := s.commitPlacement(tx, order, nil, nil, record)
+	if err != nil {
+		return nil, err
+	}
 
-// GetOrder retrieves an order by ID
-func (s *Service) GetOrder(orderID uuid.UUID) (*models.Order, error) {
-	return s.orderRepo.GetOrderByID(orderID)
-}
+	s.triggerBooks[order.Symbol].AddStop(s.convertToBookOrder(order))
 
-// GetOrdersByUserID retrieves orders for a user
-func (s *Service) GetOrdersByUserID(userID uuid.UUID, limit, offset int) ([]models.Order, error) {
-	return s.orderRepo.GetOrdersByUserID(userID, limit, offset)
+	return resp, nil
 }
 
-// validateOrderRequest validates an order request
-func (s *Service) validateOrderRequest(req *models.CreateOrderRequest) error {
-	if req.Qty.LessThanOrEqual(decimal.Zero) {
-		return fmt.Errorf("quantity must be positive")
-	}
-
-	if req.Type == models.OrderTypeLimit && (req.Price == nil || req.Price.LessThanOrEqual(decimal.Zero)) {
-		return fmt.Errorf("limit orders must have a positive price")
-	}
+// TriggerStops turns every stop order the quote crosses into a live order and
+// returns how many went live. A stop that cannot go live, such as a stop-market
+// buy whose quote gapped past a hold the user cannot top up, is rejected and its
+// hold released.
+func (s *Service) TriggerStops(quote *models.Quote) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	// Validate symbol
-	if req.Symbol != models.SymbolBTCUSD && req.Symbol != models.SymbolETHUSD {
-		return fmt.Errorf("invalid symbol: %s", req.Symbol)
+	triggerBook, ok := s.triggerBooks[quote.Symbol]
+	if !ok {
+		return 0
 	}
 
-	return nil
-}
-
-// calculateRequiredAmount calculates the amount of funds required for an order
-func (s *Service) calculateRequiredAmount(req *models.CreateOrderRequest, fillPrice *decimal.Decimal) (decimal.Decimal, error) {
-	var price decimal.Decimal
+	count := 0
+	for _, stop := range triggerBook.Triggered(quote.Bid, quote.Ask) {
+		// A triggered stop-loss cancels its take-profit before it can trade
+		if err := s.closeSiblings(stop.ID); err != nil {
+			log.Printf("Failed to cancel siblings of stop order %s: %v", stop.ID, err)
+		}
 
-	if req.Type == models.OrderTypeMarket {
-		if fillPrice == nil {
-			return decimal.Zero, fmt.Errorf("fill price required for market orders")
+		if err := s.triggerStop(stop.ID, quote); err != nil {
+			log.Printf("Failed to trigger stop order %s: %v", stop.ID, err)
+			if _, err := s.closeOrder(stop.ID, models.OrderStatusRejected, true); err != nil {
+				log.Printf("Failed to reject stop order %s: %v", stop.ID, err)
+			}
+			s.settleGroups([]uuid.UUID{stop.ID})
+			continue
 		}
-		price = *fillPrice
-	} else {
-		price = *req.Price
+		count++
 	}
 
-	if req.Side == models.OrderSideBuy {
-		// Buy orders require USD
-		return price.Mul(req.Qty), nil
-	} else {
-		// Sell orders require the base currency (BTC/ETH)
-		return req.Qty, nil
-	}
+	s.trailStops(triggerBook, quote)
+
+	return count
 }
 
-// holdFunds holds funds for an order
-func (s *Service) holdFunds(userID uuid.UUID, req *models.CreateOrderRequest, amount decimal.Decimal) error {
-	var currency models.Currency
+// trailStops ratchets the trailing stops of the quote's symbol and persists each
+// move. A buy stop's hold follows its stop price down. A move that cannot be
+// persisted is undone. Callers must hold s.mutex.
+func (s *Service) trailStops(triggerBook *limitbook.TriggerBook, quote *models.Quote) {
+	instrument, err := s.instruments.Get(quote.Symbol)
+	if err != nil {
+		return
+	}
 
-	if req.Side == models.OrderSideBuy {
-		currency = models.CurrencyUSD
-	} else {
-		// Determine base currency from symbol
-		if req.Symbol == models.SymbolBTCUSD {
-			currency = models.CurrencyBTC
-		} else if req.Symbol == models.SymbolETHUSD {
-			currency = models.CurrencyETH
-		} else {
-			return fmt.Errorf("invalid symbol: %s", req.Symbol)
+	for _, move := range triggerBook.Trail(quote.Bid, quote.Ask, instrument.TickSize) {
+		if err := s.trailStopTx(move); err != nil {
+			log.Printf("Failed to trail stop order %s: %v", move.Order.ID, err)
+			triggerBook.MoveStop(move.Order.ID, move.Previous)
 		}
 	}
-
-	return s.ledgerService.HoldFunds(userID, currency, amount)
 }
 
-// processTrade processes a completed trade
-func (s *Service) processTrade(trade *models.Trade) error {
+// trailStopTx persists a trailing stop's new stop price and releases the hold it
+// no longer needs in one transaction
+func (s *Service) trailStopTx(move limitbook.TrailMove) error {
+	order := move.Order
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get accounts
-	takerUSD, err := s.accountRepo.GetAccountByUserIDAndCurrency(trade.TakerID, models.CurrencyUSD)
-	if err != nil {
-		return fmt.Errorf("failed to get taker USD account: %w", err)
-	}
-
-	makerUSD, err := s.accountRepo.GetAccountByUserIDAndCurrency(trade.MakerID, models.CurrencyUSD)
-	if err != nil {
-		return fmt.Errorf("failed to get maker USD account: %w", err)
+	if err := s.orderRepo.TrailStop(tx, order.ID, *order.StopPrice); err != nil {
+		return err
 	}
 
-	var takerBase, makerBase *models.Account
-	if trade.Symbol == models.SymbolBTCUSD {
-		takerBase, err = s.accountRepo.GetAccountByUserIDAndCurrency(trade.TakerID, models.CurrencyBTC)
-		if err != nil {
-			return fmt.Errorf("failed to get taker BTC account: %w", err)
-		}
-
-		makerBase, err = s.accountRepo.GetAccountByUserIDAndCurrency(trade.MakerID, models.CurrencyBTC)
+	remaining := order.Qty.Sub(order.FilledQty)
+	release := restingHold(order.Side, move.Previous, remaining).Sub(restingHold(order.Side, *order.StopPrice, remaining))
+	if release.GreaterThan(decimal.Zero) {
+		currency, err := s.holdCurrency(order.Symbol, order.Side)
 		if err != nil {
-			return fmt.Errorf("failed to get maker BTC account: %w", err)
+			return err
 		}
-	} else {
-		takerBase, err = s.accountRepo.GetAccountByUserIDAndCurrency(trade.TakerID, models.CurrencyETH)
-		if err != nil {
-			return fmt.Errorf("failed to get taker ETH account: %w", err)
+		if err := s.ledgerService.ReleaseHoldTx(tx, order.UserID, currency, release); err != nil {
+			return fmt.Errorf("failed to release hold: %w", err)
 		}
+	}
 
-		makerBase, err = s.accountRepo.GetAccountByUserIDAndCurrency(trade.MakerID, models.CurrencyETH)
-		if err != nil {
-			return fmt.Errorf("failed to get maker ETH account: %w", err)
-		}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Calculate trade value
-	tradeValue := trade.Price.Mul(trade.Qty)
+	return nil
+}
 
-	// Process the trade based on side
-	if trade.Side == models.OrderSideBuy {
-		// Taker buys, maker sells
-		// Taker: USD -> BTC/ETH
-		// Maker: BTC/ETH -> USD
+// triggerStop takes a stop order live. A stop-limit order matches and rests like a
+// fresh limit order; stop-market and trailing stop orders fill like a market order
+// at the quote.
+// Callers must hold s.mutex.
+func (s *Service) triggerStop(orderID uuid.UUID, quote *models.Quote) error {
+	// Read the order under the lock so a cancel since the trigger scan is seen
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return ErrOrderNotFound
+	}
 
-		// Transfer USD from taker to maker
-		if err := s.ledgerService.TransferFunds(takerUSD.ID, makerUSD.ID, tradeValue, models.CurrencyUSD, "TRADE", trade.ID); err != nil {
-			return fmt.Errorf("failed to transfer USD: %w", err)
-		}
+	if order.Status != models.OrderStatusNew || !isUntriggeredStop(order) {
+		return ErrOrderNotOpen
+	}
 
-		// Transfer base currency from maker to taker
-		if trade.Symbol == models.SymbolBTCUSD {
-			if err := s.ledgerService.TransferFunds(makerBase.ID, takerBase.ID, trade.Qty, models.CurrencyBTC, "TRADE", trade.ID); err != nil {
-				return fmt.Errorf("failed to transfer BTC: %w", err)
-			}
-		} else {
-			if err := s.ledgerService.TransferFunds(makerBase.ID, takerBase.ID, trade.Qty, models.CurrencyETH, "TRADE", trade.ID); err != nil {
-				return fmt.Errorf("failed to transfer ETH: %w", err)
-			}
-		}
-	} else {
-		// Taker sells, maker buys
-		// Taker: BTC/ETH -> USD
-		// Maker: USD -> BTC/ETH
-
-		// Transfer base currency from taker to maker
-		if trade.Symbol == models.SymbolBTCUSD {
-			if err := s.ledgerService.TransferFunds(takerBase.ID, makerBase.ID, trade.Qty, models.CurrencyBTC, "TRADE", trade.ID); err != nil {
-				return fmt.Errorf("failed to transfer BTC: %w", err)
-			}
-		} else {
-			if err := s.ledgerService.TransferFunds(takerBase.ID, makerBase.ID, trade.Qty, models.CurrencyETH, "TRADE", trade.ID); err != nil {
-				return fmt.Errorf("failed to transfer ETH: %w", err)
+	orderBook := s.orderBooks[order.Symbol]
+	bookOrder := s.convertToBookOrder(order)
+	holdPrice := stopHoldPrice(order)
+
+	// Stop-market buys were held at the stop price; a quote that gapped above it
+	// needs the difference held before the order can fill at the ask
+	holdTopUp := decimal.Zero
+	if liveType(order.Type) == models.OrderTypeMarket {
+		fillPrice := quote.Bid
+		if order.Side == models.OrderSideBuy {
+			fillPrice = quote.Ask
+			if fillPrice.GreaterThan(holdPrice) {
+				holdTopUp = fillPrice.Sub(holdPrice).Mul(order.Qty)
 			}
 		}
+		holdPrice = fillPrice
+		bookOrder.Price = &fillPrice
+	}
 
-		// Transfer USD from maker to taker
-		if err := s.ledgerService.TransferFunds(makerUSD.ID, takerUSD.ID, tradeValue, models.CurrencyUSD, "TRADE", trade.ID); err != nil {
-			return fmt.Errorf("failed to transfer USD: %w", err)
+	triggeredAt := time.Now()
+	trades, err := s.triggerStopTx(order, bookOrder, orderBook, holdPrice, holdTopUp, triggeredAt)
+	if err != nil {
+		if bookOrder.FilledQty.GreaterThan(decimal.Zero) {
+			s.reloadBook(order.Symbol)
 		}
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	// A triggered stop-limit rests from its trigger time like a new limit order
+	if order.Type == models.OrderTypeStopLimit && (order.Status == models.OrderStatusNew || order.Status == models.OrderStatusPartiallyFilled) {
+		bookOrder.CreatedAt = triggeredAt
+		orderBook.AddOrder(bookOrder)
 	}
 
+	s.settleGroups(tradeOrderIDs(order.ID, trades))
+
 	return nil
 }
 
-// convertToBookOrder converts a models.Order to a limitbook.Order
-func (s *Service) convertToBookOrder(order *models.Order) *limitbook.Order {
-	return &limitbook.Order{
-		ID:        order.ID,
-		UserID:    order.UserID,
-		Symbol:    order.Symbol,
-		Side:      order.Side,
-		Type:      order.Type,
-		Price:     order.Price,
-		Qty:       order.Qty,
-		FilledQty: order.FilledQty,
-		Status:    order.Status,
-		CreatedAt: order.CreatedAt,
+// triggerStopTx marks a stop order triggered, tops up its hold and executes it in
+// one transaction
+func (s *Service) triggerStopTx(order *models.Order, bookOrder *limitbook.Order, orderBook *limitbook.OrderBook, holdPrice, holdTopUp decimal.Decimal, triggeredAt time.Time) ([]*models.Trade, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-}
+	defer tx.Rollback()
 
-// loadOrdersIntoBooks loads existing orders into order books
-func (s *Service) loadOrdersIntoBooks() {
-	for symbol := range s.orderBooks {
-		orders, err := s.orderRepo.GetActiveOrdersBySymbol(symbol)
-		if err != nil {
-			fmt.Printf("Failed to load orders for %s: %v\n", symbol, err)
-			continue
+	if holdTopUp.GreaterThan(decimal.Zero) {
+		if err := s.holdFunds(tx, order.UserID, order.Symbol, order.Side, holdTopUp); err != nil {
+			return nil, err
 		}
+	}
 
-		for _, order := range orders {
-			bookOrder := s.convertToBookOrder(&order)
+	if err := s.orderRepo.TriggerOrder(tx, order.ID, triggeredAt); err != nil {
+		return nil, err
+	}
+	order.TriggeredAt = &triggeredAt
+
+	trades, err := s.executeOrderTx(tx, order, bookOrder, orderBook, holdPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return trades, nil
+}
+
+// StartStopWatcher triggers stop orders from the quote stream until the context is canceled
+func (s *Service) StartStopWatcher(ctx context.Context) {
+	if s.quotesService == nil {
+		return
+	}
+
+	for symbol := range s.triggerBooks {
+		updates := s.quotesService.Subscribe(symbol)
+
+		go func(symbol models.Symbol, updates <-chan *models.Quote) {
+			defer s.quotesService.Unsubscribe(symbol, updates)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case quote, ok := <-updates:
+					if !ok {
+						return
+					}
+					if triggered := s.TriggerStops(quote); triggered > 0 {
+						log.Printf("Triggered %d stop orders for %s", triggered, symbol)
+					}
+				}
+			}
+		}(symbol, updates)
+	}
+}
+
+// isStopOrder reports whether an order type waits for a stop price
+func isStopOrder(orderType models.OrderType) bool {
+	switch orderType {
+	case models.OrderTypeStopMarket, models.OrderTypeStopLimit, models.OrderTypeTrailingStop:
+		return true
+	default:
+		return false
+	}
+}
+
+// isUntriggeredStop reports whether an order is a stop still waiting in the trigger book
+func isUntriggeredStop(order *models.Order) bool {
+	return isStopOrder(order.Type) && order.TriggeredAt == nil
+}
+
+// liveType returns the type an order trades as; stops trade as the market or
+// limit order they become once triggered
+func liveType(orderType models.OrderType) models.OrderType {
+	switch orderType {
+	case models.OrderTypeStopMarket, models.OrderTypeTrailingStop:
+		return models.OrderTypeMarket
+	case models.OrderTypeStopLimit:
+		return models.OrderTypeLimit
+	default:
+		return orderType
+	}
+}
+
+// stopHoldPrice returns the price an untriggered stop's hold is sized at: its
+// limit price, or the stop price for stop-market and trailing stop orders
+func stopHoldPrice(order *models.Order) decimal.Decimal {
+	if order.Price != nil {
+		return *order.Price
+	}
+	return *order.StopPrice
+}
+
+// commitPlacement records the placement response through record and commits
+func (s *Service) commitPlacement(tx *sql.Tx, order *models.Order, trades []*models.Trade, group []models.OrderLink, record RecordFunc) (*models.CreateOrderResponse, error) {
+	resp := buildOrderResponse(order, trades)
+	resp.Group = group
+	if record != nil {
+		if err := record(tx, resp); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return resp, nil
+}
+
+// repricePostOnly returns the price one tick behind the opposite best, where a
+// post-only order on side rests without crossing
+func repricePostOnly(orderBook *limitbook.OrderBook, side models.OrderSide, tickSize decimal.Decimal) (decimal.Decimal, error) {
+	if side == models.OrderSideBuy {
+		bestAsk, ok := orderBook.GetBestAsk()
+		if !ok || bestAsk.Sub(tickSize).LessThanOrEqual(decimal.Zero) {
+			return decimal.Zero, ErrPostOnlyWouldCross
+		}
+		return bestAsk.Sub(tickSize), nil
+	}
+
+	bestBid, ok := orderBook.GetBestBid()
+	if !ok {
+		return decimal.Zero, ErrPostOnlyWouldCross
+	}
+	return bestBid.Add(tickSize), nil
+}
+
+// checkReduceOnly verifies that a reduce-only sell of qty, together with the user's
+// other open sells on the symbol, stays within the net position built up by fills.
+// Fills are only written under the book lock, which callers hold.
+func (s *Service) checkReduceOnly(userID uuid.UUID, symbol models.Symbol, qty decimal.Decimal, excludeID uuid.UUID) error {
+	position, err := s.tradeRepo.GetNetPosition(userID, symbol)
+	if err != nil {
+		return err
+	}
+
+	openSells, err := s.orderRepo.GetOpenQty(userID, symbol, models.OrderSideSell, excludeID)
+	if err != nil {
+		return err
+	}
+
+	if qty.Add(openSells).GreaterThan(position) {
+		return ErrReduceOnlyExceedsPosition
+	}
+
+	return nil
+}
+
+// liquidityProviderTrade fills the unfilled remainder of an order against the
+// simulated liquidity provider at price. The provider has no user or order.
+func liquidityProviderTrade(bookOrder *limitbook.Order, price decimal.Decimal) *models.Trade {
+	remaining := bookOrder.Qty.Sub(bookOrder.FilledQty)
+	if remaining.LessThanOrEqual(decimal.Zero) {
+		return nil
+	}
+
+	bookOrder.FilledQty = bookOrder.Qty
+	bookOrder.Status = models.OrderStatusFilled
+
+	return &models.Trade{
+		ID:           uuid.New(),
+		Symbol:       bookOrder.Symbol,
+		Side:         bookOrder.Side,
+		Price:        price,
+		Qty:          remaining,
+		TakerID:      bookOrder.UserID,
+		MakerID:      uuid.Nil,
+		TakerOrderID: bookOrder.ID,
+		MakerOrderID: uuid.Nil,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// buildOrderResponse summarizes an order and its fills
+func buildOrderResponse(order *models.Order, trades []*models.Trade) *models.CreateOrderResponse {
+	var totalFillQty decimal.Decimal
+	var totalFillValue decimal.Decimal
+	var totalFee decimal.Decimal
+	var feeCurrency models.Currency
+	for _, trade := range trades {
+		totalFillQty = totalFillQty.Add(trade.Qty)
+		totalFillValue = totalFillValue.Add(trade.Price.Mul(trade.Qty))
+		totalFee = totalFee.Add(trade.TakerFee)
+		feeCurrency = trade.TakerFeeCurrency
+	}
+
+	// Calculate average fill price
+	var avgFillPrice *decimal.Decimal
+	if totalFillQty.GreaterThan(decimal.Zero) {
+		avg := totalFillValue.Div(totalFillQty)
+		avgFillPrice = &avg
+	}
+
+	return &models.CreateOrderResponse{
+		OrderID:      order.ID.String(),
+		Status:       order.Status,
+		FilledQty:    totalFillQty,
+		AvgFillPrice: avgFillPrice,
+		Fee:          totalFee,
+		FeeCurrency:  feeCurrency,
+	}
+}
+
+// GetOrder retrieves an order by ID
+func (s *Service) GetOrder(orderID uuid.UUID) (*models.Order, error) {
+	return s.orderRepo.GetOrderByID(orderID)
+}
+
+// CancelOrder cancels a resting order and releases the unfilled portion of its hold
+func (s *Service) CancelOrder(userID, orderID uuid.UUID) (*models.Order, error) {
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if order.UserID != userID {
+		return nil, ErrOrderNotOwned
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order, err = s.closeOrder(orderID, models.OrderStatusCanceled, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Canceling an entry or either OCO leg settles the rest of its bracket
+	s.settleGroups([]uuid.UUID{orderID})
+
+	return order, nil
+}
+
+// ExpireOrders closes every good-till-date order whose expiry is at or before now
+// and releases its hold. It returns how many orders were expired.
+func (s *Service) ExpireOrders(now time.Time) (int, error) {
+	expired, err := s.orderRepo.GetExpiredOrders(now)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, order := range expired {
+		if err := s.expireOrder(order.ID); err != nil {
+			// The order filled or was canceled since the scan
+			if errors.Is(err, ErrOrderNotOpen) {
+				continue
+			}
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// expireOrder closes a single order as expired under the book lock
+func (s *Service) expireOrder(orderID uuid.UUID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.closeOrder(orderID, models.OrderStatusExpired, true); err != nil {
+		return err
+	}
+
+	s.settleGroups([]uuid.UUID{orderID})
+
+	return nil
+}
+
+// StartExpirer periodically expires good-till-date orders until the context is canceled
+func (s *Service) StartExpirer(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				expired, err := s.ExpireOrders(now)
+				if err != nil {
+					log.Printf("Failed to expire orders: %v", err)
+					continue
+				}
+				if expired > 0 {
+					log.Printf("Expired %d orders", expired)
+				}
+			}
+		}
+	}()
+}
+
+// closeOrder takes an open limit order out of the book, or an untriggered stop out
+// of the trigger book, and moves it to status. With releaseHold set the hold on its
+// unfilled quantity is released; OCO legs closed for a sibling leave the shared hold
+// to it. Callers must hold s.mutex.
+func (s *Service) closeOrder(orderID uuid.UUID, status models.OrderStatus, releaseHold bool) (*models.Order, error) {
+	// Read the order under the lock so fills since the caller looked are seen
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	// Pending bracket children hold nothing and are in no book yet
+	if order.Status == models.OrderStatusPending {
+		order.Status = status
+		if err := s.cancelOrderTx(order, "", decimal.Zero); err != nil {
+			return nil, err
+		}
+		return order, nil
+	}
+
+	if order.Status != models.OrderStatusNew && order.Status != models.OrderStatusPartiallyFilled {
+		return nil, ErrOrderNotOpen
+	}
+
+	untriggered := isUntriggeredStop(order)
+
+	// Market orders never rest, so there is no priced hold to release
+	if !untriggered && (liveType(order.Type) != models.OrderTypeLimit || order.Price == nil) {
+		return nil, ErrOrderNotOpen
+	}
+
+	// Take the order out of its book first so it cannot match or trigger while we
+	// close it. The book holds the freshest fill state for resting orders.
+	orderBook := s.orderBooks[order.Symbol]
+	triggerBook := s.triggerBooks[order.Symbol]
+	var bookOrder *limitbook.Order
+	var inBook bool
+	var holdPrice decimal.Decimal
+	if untriggered {
+		bookOrder, inBook = triggerBook.RemoveStop(order.ID)
+		holdPrice = stopHoldPrice(order)
+	} else {
+		bookOrder, inBook = orderBook.RemoveOrder(order.ID)
+		if inBook {
+			order.FilledQty = bookOrder.FilledQty
+		}
+		holdPrice = *order.Price
+	}
+
+	currency, err := s.holdCurrency(order.Symbol, order.Side)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseAmount := decimal.Zero
+	if releaseHold {
+		releaseAmount = restingHold(order.Side, holdPrice, order.Qty.Sub(order.FilledQty))
+	}
+	order.Status = status
+
+	if err := s.cancelOrderTx(order, currency, releaseAmount); err != nil {
+		// Put the order back so it keeps working if the cancel did not go through
+		if inBook && untriggered {
+			triggerBook.AddStop(bookOrder)
+		} else if inBook {
+			orderBook.AddOrder(bookOrder)
+		}
+		return nil, err
+	}
+
+	if inBook {
+		bookOrder.Status = status
+	}
+
+	return order, nil
+}
+
+// cancelOrderTx persists a cancellation and releases its hold in one transaction
+func (s *Service) cancelOrderTx(order *models.Order, currency models.Currency, releaseAmount decimal.Decimal) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.orderRepo.UpdateOrder(tx, order); err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if releaseAmount.GreaterThan(decimal.Zero) {
+		if err := s.ledgerService.ReleaseHoldTx(tx, order.UserID, currency, releaseAmount); err != nil {
+			return fmt.Errorf("failed to release hold: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AmendOrder changes the price and/or quantity of a resting limit order and adjusts
+// its hold by the difference. Reducing the quantity keeps the order's place in the
+// queue; a new price or a larger quantity sends it to the back, and a new price that
+// crosses the book matches like a fresh order would.
+func (s *Service) AmendOrder(userID, orderID uuid.UUID, req *models.AmendOrderRequest) (*models.Order, error) {
+	if req.Price == nil && req.Qty == nil {
+		return nil, fmt.Errorf("%w: price or qty required", ErrInvalidAmendment)
+	}
+	if req.Price != nil && req.Price.LessThanOrEqual(decimal.Zero) {
+		return nil, fmt.Errorf("%w: price must be positive", ErrInvalidAmendment)
+	}
+
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if order.UserID != userID {
+		return nil, ErrOrderNotOwned
+	}
+
+	instrument, err := s.instruments.Get(order.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	if req.Price != nil {
+		if err := instruments.CheckPrice(instrument, *req.Price); err != nil {
+			return nil, err
+		}
+	}
+	if req.Qty != nil {
+		if err := instruments.CheckQty(instrument, *req.Qty); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Read the order again under the lock so an amendment or fill since the first
+	// read is seen; the hold is adjusted from its current price and quantity
+	order, err = s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	// OCO legs share one hold sized to their common quantity
+	link, err := s.linkRepo.GetLink(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil && link.Role != models.OrderLinkRoleParent {
+		return nil, fmt.Errorf("%w: bracket legs cannot be amended", ErrInvalidAmendment)
+	}
+
+	if liveType(order.Type) != models.OrderTypeLimit || order.Price == nil ||
+		(order.Status != models.OrderStatusNew && order.Status != models.OrderStatusPartiallyFilled) {
+		return nil, ErrOrderNotOpen
+	}
+
+	// The book holds the freshest fill state for resting orders
+	orderBook := s.orderBooks[order.Symbol]
+	bookOrder, inBook := orderBook.GetOrder(order.ID)
+	if !inBook {
+		return nil, ErrOrderNotOpen
+	}
+	order.FilledQty = bookOrder.FilledQty
+
+	newPrice := *order.Price
+	if req.Price != nil {
+		newPrice = *req.Price
+	}
+	newQty := order.Qty
+	if req.Qty != nil {
+		newQty = *req.Qty
+	}
+	if newQty.LessThanOrEqual(order.FilledQty) {
+		return nil, fmt.Errorf("%w: qty must exceed the filled quantity %s", ErrInvalidAmendment, order.FilledQty)
+	}
+	if err := instruments.CheckNotional(instrument, newPrice, newQty); err != nil {
+		return nil, err
+	}
+
+	requeue := !newPrice.Equal(*order.Price) || newQty.GreaterThan(order.Qty)
+
+	if order.ReduceOnly && newQty.GreaterThan(order.Qty) {
+		if err := s.checkReduceOnly(order.UserID, order.Symbol, newQty.Sub(order.FilledQty), order.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Post-only orders are never repriced on amend; crossing is rejected
+	if order.PostOnly && !newPrice.Equal(*order.Price) {
+		candidate := *bookOrder
+		candidate.Price = &newPrice
+		if orderBook.WouldCross(&candidate) {
+			return nil, ErrPostOnlyWouldCross
+		}
+	}
+
+	currency, err := s.holdCurrency(order.Symbol, order.Side)
+	if err != nil {
+		return nil, err
+	}
+	oldHold := restingHold(order.Side, *order.Price, order.Qty.Sub(order.FilledQty))
+	newHold := restingHold(order.Side, newPrice, newQty.Sub(order.FilledQty))
+
+	if !requeue {
+		// Reduce in place: the order keeps its queue position
+		order.Qty = newQty
+		if _, err := s.amendOrderTx(order, nil, currency, newHold.Sub(oldHold), false); err != nil {
+			return nil, err
+		}
+		orderBook.ReduceOrder(order.ID, newQty)
+		return order, nil
+	}
+
+	// Losing priority is a cancel and re-add, so the order leaves its level first
+	orderBook.RemoveOrder(order.ID)
+	order.Price = &newPrice
+	order.Qty = newQty
+	bookOrder.Price = &newPrice
+	bookOrder.Qty = newQty
+
+	trades, err := s.amendOrderTx(order, bookOrder, currency, newHold.Sub(oldHold), true)
+	if err != nil {
+		// The book was changed before the transaction; rebuild it from the database
+		s.reloadBook(order.Symbol)
+		return nil, err
+	}
+
+	if order.Status == models.OrderStatusNew || order.Status == models.OrderStatusPartiallyFilled {
+		orderBook.AddOrder(bookOrder)
+	}
+
+	s.settleGroups(tradeOrderIDs(order.ID, trades))
+
+	return order, nil
+}
+
+// amendOrderTx adjusts an order's hold by holdDelta, matches a requeued order against
+// the book and persists the amendment in one transaction
+func (s *Service) amendOrderTx(order *models.Order, bookOrder *limitbook.Order, currency models.Currency, holdDelta decimal.Decimal, requeue bool) ([]*models.Trade, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Take the extra hold before any fills settle against it
+	if holdDelta.GreaterThan(decimal.Zero) {
+		if err := s.ledgerService.HoldFundsTx(tx, order.UserID, currency, holdDelta); err != nil {
+			return nil, err
+		}
+	} else if holdDelta.LessThan(decimal.Zero) {
+		if err := s.ledgerService.ReleaseHoldTx(tx, order.UserID, currency, holdDelta.Neg()); err != nil {
+			return nil, fmt.Errorf("failed to release hold: %w", err)
+		}
+	}
+
+	var trades []*models.Trade
+	if bookOrder != nil {
+		trades = s.orderBooks[order.Symbol].MatchOrder(bookOrder)
+		for _, trade := range trades {
+			if err := s.processTrade(tx, trade, *order.Price); err != nil {
+				return nil, fmt.Errorf("failed to process trade: %w", err)
+			}
+		}
+
+		order.FilledQty = bookOrder.FilledQty
+		if order.FilledQty.Equal(order.Qty) {
+			order.Status = models.OrderStatusFilled
+		} else if order.FilledQty.GreaterThan(decimal.Zero) {
+			order.Status = models.OrderStatusPartiallyFilled
+		}
+	}
+
+	if err := s.orderRepo.AmendOrder(tx, order, requeue); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return trades, nil
+}
+
+// restingHold returns the funds reserved by the unfilled part of a limit order
+func restingHold(side models.OrderSide, price, remainingQty decimal.Decimal) decimal.Decimal {
+	if side == models.OrderSideBuy {
+		return price.Mul(remainingQty)
+	}
+	return remainingQty
+}
+
+// GetOrdersByUserID retrieves orders for a user
+func (s *Service) GetOrdersByUserID(userID uuid.UUID, limit, offset int) ([]models.Order, error) {
+	return s.orderRepo.GetOrdersByUserID(userID, limit, offset)
+}
+
+// GetFills retrieves a user's most recent fills across all orders
+func (s *Service) GetFills(userID uuid.UUID, limit int) ([]models.Fill, error) {
+	if limit <= 0 {
+		limit = DefaultOrdersPageSize
+	}
+	if limit > MaxOrdersPageSize {
+		limit = MaxOrdersPageSize
+	}
+
+	return s.tradeRepo.GetFillsByUserID(userID, limit)
+}
+
+// GetOrderFills retrieves the fills of one of the user's orders
+func (s *Service) GetOrderFills(userID, orderID uuid.UUID) ([]models.Fill, error) {
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if order.UserID != userID {
+		return nil, ErrOrderNotOwned
+	}
+
+	return s.tradeRepo.GetFillsByOrderID(orderID)
+}
+
+// ListOrders retrieves a page of a user's order history, newest first
+func (s *Service) ListOrders(userID uuid.UUID, req *models.ListOrdersRequest) (*models.ListOrdersResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultOrdersPageSize
+	}
+	if limit > MaxOrdersPageSize {
+		limit = MaxOrdersPageSize
+	}
+
+	filter := &database.OrderFilter{
+		Symbol:      req.Symbol,
+		Side:        req.Side,
+		Status:      req.Status,
+		Type:        req.Type,
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		// Fetch one extra row to know whether another page follows
+		Limit: limit + 1,
+	}
+
+	if req.Cursor != "" {
+		createdAt, id, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterCreatedAt = &createdAt
+		filter.AfterID = &id
+	}
+
+	orders, err := s.orderRepo.ListOrders(userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ListOrdersResponse{Orders: orders}
+	if len(orders) > limit {
+		response.Orders = orders[:limit]
+		last := response.Orders[limit-1]
+		response.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return response, nil
+}
+
+// encodeCursor encodes a keyset position as an opaque cursor
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor decodes a cursor produced by encodeCursor
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
+
+// validateOrderRequest validates an order request
+func (s *Service) validateOrderRequest(req *models.CreateOrderRequest) error {
+	if req.Qty.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("quantity must be positive")
+	}
+
+	if liveType(req.Type) == models.OrderTypeLimit && (req.Price == nil || req.Price.LessThanOrEqual(decimal.Zero)) {
+		return fmt.Errorf("limit orders must have a positive price")
+	}
+
+	if req.Type != models.OrderTypeTrailingStop && (req.TrailOffset != nil || req.TrailPercent != nil) {
+		return fmt.Errorf("trail_offset and trail_percent are only valid for trailing stops")
+	}
+
+	switch req.Type {
+	case models.OrderTypeMarket, models.OrderTypeLimit:
+		if req.StopPrice != nil {
+			return fmt.Errorf("stop_price is only valid for stop orders")
+		}
+	case models.OrderTypeStopMarket, models.OrderTypeStopLimit:
+		if req.StopPrice == nil || req.StopPrice.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("stop orders must have a positive stop_price")
+		}
+		if req.Type == models.OrderTypeStopMarket && req.Price != nil {
+			return fmt.Errorf("stop-market orders cannot have a price")
+		}
+		if req.TimeInForce != models.TimeInForceGTC && req.TimeInForce != models.TimeInForceGTD {
+			return fmt.Errorf("stop orders must be GTC or GTD")
+		}
+	case models.OrderTypeTrailingStop:
+		if req.StopPrice != nil || req.Price != nil {
+			return fmt.Errorf("trailing stops cannot have a price or stop_price")
+		}
+		if (req.TrailOffset == nil) == (req.TrailPercent == nil) {
+			return fmt.Errorf("trailing stops must have one of trail_offset or trail_percent")
+		}
+		if req.TrailOffset != nil && !req.TrailOffset.IsPositive() {
+			return fmt.Errorf("trail_offset must be positive")
+		}
+		if req.TrailPercent != nil && (!req.TrailPercent.IsPositive() || req.TrailPercent.GreaterThanOrEqual(decimal.NewFromInt(100))) {
+			return fmt.Errorf("trail_percent must be between 0 and 100")
+		}
+		if req.TimeInForce != models.TimeInForceGTC && req.TimeInForce != models.TimeInForceGTD {
+			return fmt.Errorf("stop orders must be GTC or GTD")
+		}
+	default:
+		return fmt.Errorf("invalid order type: %s", req.Type)
+	}
+
+	instrument, err := s.instruments.Get(req.Symbol)
+	if err != nil {
+		return err
+	}
+	if instrument.Status != models.InstrumentStatusTrading {
+		return fmt.Errorf("%w: %s is %s", ErrInstrumentNotTrading, req.Symbol, instrument.Status)
+	}
+	if err := validateTradingRules(instrument, req); err != nil {
+		return err
+	}
+
+	if req.DisplayQty != nil {
+		if req.Type != models.OrderTypeLimit {
+			return fmt.Errorf("only limit orders can have a display_qty")
+		}
+		if !req.DisplayQty.IsPositive() || req.DisplayQty.GreaterThanOrEqual(req.Qty) {
+			return fmt.Errorf("display_qty must be positive and below qty")
+		}
+		if req.TimeInForce == models.TimeInForceIOC || req.TimeInForce == models.TimeInForceFOK {
+			return fmt.Errorf("iceberg orders cannot be %s", req.TimeInForce)
+		}
+	}
+
+	if req.PostOnly {
+		if req.Type != models.OrderTypeLimit {
+			return fmt.Errorf("only limit orders can be post-only")
+		}
+		if req.TimeInForce == models.TimeInForceIOC || req.TimeInForce == models.TimeInForceFOK {
+			return fmt.Errorf("post-only orders cannot be %s", req.TimeInForce)
+		}
+	} else if req.PostOnlyReprice {
+		return fmt.Errorf("post_only_reprice requires post_only")
+	}
+
+	if req.TakeProfit != nil || req.StopLoss != nil {
+		if err := validateBracket(req); err != nil {
+			return err
+		}
+	}
+
+	// Spot positions cannot go short, so only sells can reduce one
+	if req.ReduceOnly && req.Side != models.OrderSideSell {
+		return fmt.Errorf("only sell orders can be reduce-only")
+	}
+
+	switch req.TimeInForce {
+	case models.TimeInForceGTC, models.TimeInForceIOC, models.TimeInForceFOK:
+		if req.ExpiresAt != nil {
+			return fmt.Errorf("expires_at is only valid for GTD orders")
+		}
+	case models.TimeInForceGTD:
+		if req.Type == models.OrderTypeMarket {
+			return fmt.Errorf("market orders cannot be GTD")
+		}
+		if req.ExpiresAt == nil || !req.ExpiresAt.After(time.Now()) {
+			return fmt.Errorf("GTD orders must have a future expires_at")
+		}
+	default:
+		return fmt.Errorf("invalid time in force: %s", req.TimeInForce)
+	}
+
+	return nil
+}
+
+// validateTradingRules checks an order's prices and trail offset against the
+// instrument's tick size, its quantity and display quantity against the lot size
+// and, for priced orders, its value against the minimum notional. Market orders and
+// trailing stops are valued once quoted.
+func validateTradingRules(instrument *models.Instrument, req *models.CreateOrderRequest) error {
+	if err := instruments.CheckQty(instrument, req.Qty); err != nil {
+		return err
+	}
+	if req.DisplayQty != nil {
+		if err := instruments.CheckQty(instrument, *req.DisplayQty); err != nil {
+			return err
+		}
+	}
+
+	prices := []*decimal.Decimal{req.Price, req.StopPrice, req.TrailOffset}
+	for _, leg := range []*models.BracketLeg{req.TakeProfit, req.StopLoss} {
+		if leg != nil {
+			prices = append(prices, leg.Price, leg.StopPrice)
+		}
+	}
+	for _, price := range prices {
+		if price == nil {
+			continue
+		}
+		if err := instruments.CheckPrice(instrument, *price); err != nil {
+			return err
+		}
+	}
+
+	// Stop-market orders are valued at their stop price
+	notionalPrice := req.Price
+	if notionalPrice == nil {
+		notionalPrice = req.StopPrice
+	}
+	if notionalPrice != nil {
+		return instruments.CheckNotional(instrument, *notionalPrice, req.Qty)
+	}
+
+	return nil
+}
+
+// calculateRequiredAmount calculates the amount of funds required for an order
+func (s *Service) calculateRequiredAmount(req *models.CreateOrderRequest, fillPrice *decimal.Decimal) (decimal.Decimal, error) {
+	var price decimal.Decimal
+
+	switch req.Type {
+	case models.OrderTypeMarket:
+		if fillPrice == nil {
+			return decimal.Zero, fmt.Errorf("fill price required for market orders")
+		}
+		price = *fillPrice
+	case models.OrderTypeStopMarket, models.OrderTypeTrailingStop:
+		// Held at the stop price; any gap past it is topped up on trigger
+		price = *req.StopPrice
+	default:
+		price = *req.Price
+	}
+
+	if req.Side == models.OrderSideBuy {
+		// Buy orders require the quote currency
+		return price.Mul(req.Qty), nil
+	} else {
+		// Sell orders require the base currency
+		return req.Qty, nil
+	}
+}
+
+// holdFunds holds funds for an order within the placement transaction
+func (s *Service) holdFunds(tx *sql.Tx, userID uuid.UUID, symbol models.Symbol, side models.OrderSide, amount decimal.Decimal) error {
+	currency, err := s.holdCurrency(symbol, side)
+	if err != nil {
+		return err
+	}
+
+	return s.ledgerService.HoldFundsTx(tx, userID, currency, amount)
+}
+
+// holdCurrency returns the currency reserved by an order on the given side: buys
+// pay in the quote currency, sells deliver the base currency
+func (s *Service) holdCurrency(symbol models.Symbol, side models.OrderSide) (models.Currency, error) {
+	instrument, err := s.instruments.Get(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	if side == models.OrderSideBuy {
+		return instrument.QuoteCurrency, nil
+	}
+	return instrument.BaseCurrency, nil
+}
+
+// processTrade settles a completed trade within the placement transaction
+func (s *Service) processTrade(tx *sql.Tx, trade *models.Trade, takerHoldPrice decimal.Decimal) error {
+	instrument, err := s.instruments.Get(trade.Symbol)
+	if err != nil {
+		return err
+	}
+
+	settlement := &ledger.Settlement{
+		TradeID:       trade.ID,
+		BaseCurrency:  instrument.BaseCurrency,
+		QuoteCurrency: instrument.QuoteCurrency,
+		Price:         trade.Price,
+		Qty:           trade.Qty,
+	}
+	trade.NotionalUSD = s.usdValue(instrument.QuoteCurrency, trade.Price.Mul(trade.Qty))
+
+	if err := s.chargeFees(trade, settlement); err != nil {
+		return err
+	}
+
+	if trade.Side == models.OrderSideBuy {
+		// Taker buys, maker sells; the taker's hold may be sized above the fill price
+		settlement.BuyerID = trade.TakerID
+		settlement.SellerID = trade.MakerID
+		settlement.BuyerHoldPrice = takerHoldPrice
+		settlement.BuyerFee = trade.TakerFee
+		settlement.SellerFee = trade.MakerFee
+	} else {
+		// Taker sells, maker buys; trades print at the maker's limit price
+		settlement.BuyerID = trade.MakerID
+		settlement.SellerID = trade.TakerID
+		settlement.BuyerHoldPrice = trade.Price
+		settlement.BuyerFee = trade.MakerFee
+		settlement.SellerFee = trade.TakerFee
+	}
+
+	if err := s.ledgerService.SettleTradeTx(tx, settlement); err != nil {
+		return fmt.Errorf("failed to settle trade: %w", err)
+	}
+
+	// Record the fill on the resting order; liquidity provider fills have none
+	if trade.MakerOrderID != uuid.Nil {
+		if err := s.orderRepo.AddFill(tx, trade.MakerOrderID, trade.Qty, trade.CreatedAt); err != nil {
+			return fmt.Errorf("failed to update maker order: %w", err)
+		}
+	}
+
+	if err := s.tradeRepo.CreateTrade(tx, trade); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// usdValue converts an amount of a currency to USD through the current quote chain.
+// Amounts that cannot be converted, for lack of quotes, are valued at zero.
+func (s *Service) usdValue(currency models.Currency, amount decimal.Decimal) decimal.Decimal {
+	if currency == models.CurrencyUSD {
+		return amount
+	}
+	if s.quotesService == nil {
+		return decimal.Zero
+	}
+
+	rate, ok := quotes.USDRates(s.quotesService.Mids())[currency]
+	if !ok {
+		return decimal.Zero
+	}
+	return amount.Mul(rate)
+}
+
+// chargeFees prices a trade's taker and maker fees from each user's 30-day volume
+// tier. Each side pays in the currency it receives: the buyer in the base
+// currency, the seller in the quote currency. The liquidity provider pays none.
+func (s *Service) chargeFees(trade *models.Trade, settlement *ledger.Settlement) error {
+	since := time.Now().Add(-fees.VolumeWindow)
+	tierFor := func(userID uuid.UUID) (models.FeeTier, error) {
+		volume, err := s.tradeRepo.GetUserVolume(userID, since)
+		if err != nil {
+			return models.FeeTier{}, err
+		}
+		return s.feeSchedule.TierFor(volume), nil
+	}
+
+	// received returns what a side receives and in which currency
+	value := trade.Price.Mul(trade.Qty)
+	received := func(buyer bool) (decimal.Decimal, models.Currency) {
+		if buyer {
+			return trade.Qty, settlement.BaseCurrency
+		}
+		return value, settlement.QuoteCurrency
+	}
+
+	takerTier, err := tierFor(trade.TakerID)
+	if err != nil {
+		return err
+	}
+	amount, currency := received(trade.Side == models.OrderSideBuy)
+	trade.TakerFee = fees.Fee(amount, takerTier.TakerBps)
+	trade.TakerFeeCurrency = currency
+
+	amount, currency = received(trade.Side == models.OrderSideSell)
+	trade.MakerFee = decimal.Zero
+	trade.MakerFeeCurrency = currency
+	if trade.MakerID != uuid.Nil {
+		makerTier, err := tierFor(trade.MakerID)
+		if err != nil {
+			return err
+		}
+		trade.MakerFee = fees.Fee(amount, makerTier.MakerBps)
+	}
+
+	return nil
+}
+
+// convertToBookOrder converts a models.Order to a limitbook.Order
+func (s *Service) convertToBookOrder(order *models.Order) *limitbook.Order {
+	return &limitbook.Order{
+		ID:           order.ID,
+		UserID:       order.UserID,
+		Symbol:       order.Symbol,
+		Side:         order.Side,
+		Type:         order.Type,
+		Price:        order.Price,
+		Qty:          order.Qty,
+		FilledQty:    order.FilledQty,
+		Status:       order.Status,
+		PostOnly:     order.PostOnly,
+		StopPrice:    order.StopPrice,
+		CreatedAt:    order.CreatedAt,
+		TrailOffset:  order.TrailOffset,
+		TrailPercent: order.TrailPercent,
+		DisplayQty:   order.DisplayQty,
+	}
+}
+
+// reloadBook rebuilds a symbol's order book from the committed active orders. If
+// they cannot be read the current book is kept rather than emptied.
+func (s *Service) reloadBook(symbol models.Symbol) {
+	orders, err := s.orderRepo.GetActiveOrdersBySymbol(symbol)
+	if err != nil {
+		fmt.Printf("Failed to reload orders for %s: %v\n", symbol, err)
+		return
+	}
+
+	bookOrders := make([]*limitbook.Order, 0, len(orders))
+	for _, order := range orders {
+		// Untriggered stops live in the trigger book, which matching never changes
+		if liveType(order.Type) == models.OrderTypeMarket || isUntriggeredStop(&order) {
+			continue
+		}
+		bookOrders = append(bookOrders, s.convertToBookOrder(&order))
+	}
+
+	// The book is reset in place under its own lock, so readers never see it
+	// swapped and its sequence keeps counting up
+	s.orderBooks[symbol].Reset(bookOrders)
+}
+
+// loadOrdersIntoBooks loads existing orders into order books
+func (s *Service) loadOrdersIntoBooks() {
+	for symbol := range s.orderBooks {
+		orders, err := s.orderRepo.GetActiveOrdersBySymbol(symbol)
+		if err != nil {
+			fmt.Printf("Failed to load orders for %s: %v\n", symbol, err)
+			continue
+		}
+
+		for _, order := range orders {
+			bookOrder := s.convertToBookOrder(&order)
+
+			// Stops wait in the trigger book until the quote crosses them
+			if isUntriggeredStop(&order) {
+				s.triggerBooks[symbol].AddStop(bookOrder)
+				continue
+			}
+
+			// Market orders never rest; skip any left open by older versions
+			if liveType(order.Type) == models.OrderTypeMarket {
+				continue
+			}
 			s.orderBooks[symbol].AddOrder(bookOrder)
 		}
 	}
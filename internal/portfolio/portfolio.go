@@ -0,0 +1,200 @@
+package portfolio
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"microcoin/internal/database"
+	"microcoin/internal/models"
+	"microcoin/internal/quotes"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Service computes balances, positions and PnL for a user
+type Service struct {
+	accountRepo   *database.AccountRepository
+	tradeRepo     *database.TradeRepository
+	quotesService *quotes.Service
+}
+
+// NewService creates a new portfolio service
+func NewService(db *sql.DB, quotesService *quotes.Service) *Service {
+	return &Service{
+		accountRepo:   database.NewAccountRepository(db),
+		tradeRepo:     database.NewTradeRepository(db),
+		quotesService: quotesService,
+	}
+}
+
+// GetPortfolio builds a user's portfolio marked to the current mid prices
+func (s *Service) GetPortfolio(userID uuid.UUID) (*models.Portfolio, error) {
+	accounts, err := s.accountRepo.GetAccountsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+
+	fills, err := s.tradeRepo.GetFillHistoryByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	marks := s.markPrices()
+	positions, pnl := BuildPositions(fills, marks)
+	rates := quotes.USDRates(marks)
+
+	balances := []models.AccountBalance{}
+	totalEquity := decimal.Zero
+	for _, account := range accounts {
+		total := account.BalanceAvailable.Add(account.BalanceHold)
+		balances = append(balances, models.AccountBalance{
+			Currency:         account.Currency,
+			BalanceAvailable: account.BalanceAvailable,
+			BalanceHold:      account.BalanceHold,
+			BalanceTotal:     total,
+		})
+
+		// Balances with no quote chain to USD cannot be valued and are left out of equity
+		if rate, ok := rates[account.Currency]; ok {
+			totalEquity = totalEquity.Add(total.Mul(rate))
+		}
+	}
+
+	return &models.Portfolio{
+		Balances:    balances,
+		Positions:   positions,
+		PnL:         pnl,
+		TotalEquity: totalEquity,
+	}, nil
+}
+
+// markPrices returns the current mid price of every symbol with a quote
+func (s *Service) markPrices() map[models.Symbol]decimal.Decimal {
+	if s.quotesService == nil {
+		return make(map[models.Symbol]decimal.Decimal)
+	}
+	return s.quotesService.Mids()
+}
+
+// baseCurrency returns the currency a symbol trades
+func baseCurrency(symbol models.Symbol) models.Currency {
+	base, _, _ := strings.Cut(string(symbol), "-")
+	return models.Currency(base)
+}
+
+// quoteCurrency returns the currency a symbol is priced in
+func quoteCurrency(symbol models.Symbol) models.Currency {
+	_, quote, _ := strings.Cut(string(symbol), "-")
+	return models.Currency(quote)
+}
+
+// position tracks the running state of one symbol while replaying fills
+type position struct {
+	qty      decimal.Decimal
+	avgPrice decimal.Decimal
+	realized decimal.Decimal
+}
+
+// apply folds a fill into the position using average cost. Fills that add to the
+// position move the average price; fills against it realize PnL at that price.
+// A fee paid in the base currency comes out of the position and is charged to
+// realized PnL at the fill price.
+func (p *position) apply(fill models.Fill) {
+	qty := fill.Qty
+	if fill.Side == models.OrderSideSell {
+		qty = qty.Neg()
+	}
+
+	fee := fill.Fee
+	if fill.FeeCurrency == baseCurrency(fill.Symbol) {
+		qty = qty.Sub(fill.Fee)
+		fee = fill.Fee.Mul(fill.Price)
+	}
+
+	switch {
+	case qty.IsZero():
+		// The fee consumed the whole fill
+	case p.qty.IsZero() || p.qty.Sign() == qty.Sign():
+		cost := p.qty.Abs().Mul(p.avgPrice).Add(qty.Abs().Mul(fill.Price))
+		p.qty = p.qty.Add(qty)
+		p.avgPrice = cost.Div(p.qty.Abs())
+	default:
+		closed := decimal.Min(p.qty.Abs(), qty.Abs())
+		pnl := closed.Mul(fill.Price.Sub(p.avgPrice))
+		if p.qty.IsNegative() {
+			pnl = pnl.Neg()
+		}
+		p.realized = p.realized.Add(pnl)
+
+		previous := p.qty
+		p.qty = p.qty.Add(qty)
+		switch {
+		case p.qty.IsZero():
+			p.avgPrice = decimal.Zero
+		case p.qty.Sign() != previous.Sign():
+			// The fill flipped the position; the remainder opens at the fill price
+			p.avgPrice = fill.Price
+		}
+	}
+
+	p.realized = p.realized.Sub(fee)
+}
+
+// BuildPositions replays fills in execution order into per-symbol positions.
+// Open quantity is marked to marks; symbols without a mark are held at cost.
+// Positions report PnL in their quote currency; the totals convert it to USD
+// through the marks' quote chains and leave out positions that cannot be converted.
+func BuildPositions(fills []models.Fill, marks map[models.Symbol]decimal.Decimal) ([]models.Position, models.PnL) {
+	states := make(map[models.Symbol]*position)
+	for _, fill := range fills {
+		state, exists := states[fill.Symbol]
+		if !exists {
+			state = &position{}
+			states[fill.Symbol] = state
+		}
+		state.apply(fill)
+	}
+
+	rates := quotes.USDRates(marks)
+	positions := []models.Position{}
+	pnl := models.PnL{
+		Realized:   decimal.Zero,
+		Unrealized: decimal.Zero,
+	}
+
+	for symbol, state := range states {
+		mark, ok := marks[symbol]
+		if !ok {
+			mark = state.avgPrice
+		}
+		unrealized := state.qty.Mul(mark.Sub(state.avgPrice))
+
+		quote := quoteCurrency(symbol)
+		positions = append(positions, models.Position{
+			Symbol:        symbol,
+			QuoteCurrency: quote,
+			Qty:           state.qty,
+			AvgPrice:      state.avgPrice,
+			MarkPrice:     mark,
+			RealizedPnL:   state.realized,
+			UnrealizedPnL: unrealized,
+		})
+
+		rate, ok := rates[quote]
+		if !ok {
+			continue
+		}
+		pnl.Realized = pnl.Realized.Add(state.realized.Mul(rate))
+		pnl.Unrealized = pnl.Unrealized.Add(unrealized.Mul(rate))
+	}
+	pnl.Total = pnl.Realized.Add(pnl.Unrealized)
+
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Symbol < positions[j].Symbol
+	})
+
+	return positions, pnl
+}
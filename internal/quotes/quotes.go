@@ -32,13 +32,13 @@ func NewService(redisClient *redis.Client) *Service {
 	}
 }
 
-// Start starts the quotes service
-func (s *Service) Start(ctx context.Context) error {
+// Start starts the quotes service for the given symbols
+func (s *Service) Start(ctx context.Context, symbols []models.Symbol) error {
 	// Subscribe to Redis channels for quotes
-	go s.subscribeToQuotes(ctx)
+	go s.subscribeToQuotes(ctx, symbols)
 
 	// Start mock quote generator (in production, this would connect to real data feeds)
-	go s.generateMockQuotes(ctx)
+	go s.generateMockQuotes(ctx, symbols)
 
 	return nil
 }
@@ -56,6 +56,19 @@ func (s *Service) GetQuote(symbol models.Symbol) (*models.Quote, error) {
 	return quote, nil
 }
 
+// GetQuotes returns the latest quote of every symbol that has one
+func (s *Service) GetQuotes() []*models.Quote {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	quotes := make([]*models.Quote, 0, len(s.quotes))
+	for _, quote := range s.quotes {
+		quotes = append(quotes, quote)
+	}
+
+	return quotes
+}
+
 // Subscribe subscribes to quote updates for a symbol
 func (s *Service) Subscribe(symbol models.Symbol) <-chan *models.Quote {
 	s.subMutex.Lock()
@@ -83,8 +96,13 @@ func (s *Service) Unsubscribe(symbol models.Symbol, ch <-chan *models.Quote) {
 }
 
 // subscribeToQuotes subscribes to Redis channels for quote updates
-func (s *Service) subscribeToQuotes(ctx context.Context) {
-	pubsub := s.redisClient.Subscribe(ctx, "quotes:BTC-USD", "quotes:ETH-USD")
+func (s *Service) subscribeToQuotes(ctx context.Context, symbols []models.Symbol) {
+	channels := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		channels[i] = fmt.Sprintf("quotes:%s", symbol)
+	}
+
+	pubsub := s.redisClient.Subscribe(ctx, channels...)
 	defer pubsub.Close()
 
 	ch := pubsub.Channel()
@@ -105,6 +123,11 @@ func (s *Service) subscribeToQuotes(ctx context.Context) {
 	}
 }
 
+// SetQuote installs a quote directly, bypassing the feed
+func (s *Service) SetQuote(quote *models.Quote) {
+	s.updateQuote(quote)
+}
+
 // updateQuote updates the latest quote and notifies subscribers
 func (s *Service) updateQuote(quote *models.Quote) {
 	s.mutex.Lock()
@@ -125,55 +148,65 @@ func (s *Service) updateQuote(quote *models.Quote) {
 	}
 }
 
+// mockUSDPrices seeds the mock feed with a USD price per currency; a pair is priced
+// at the ratio of its two currencies, and unknown currencies start at 100 USD
+var mockUSDPrices = map[models.Currency]decimal.Decimal{
+	models.CurrencyUSD: decimal.NewFromInt(1),
+	models.CurrencyBTC: decimal.NewFromFloat(60000.0),
+	models.CurrencyETH: decimal.NewFromFloat(3000.0),
+}
+
+// mockStartPrice returns the initial mock price of a BASE-QUOTE symbol
+func mockStartPrice(symbol models.Symbol) decimal.Decimal {
+	usdPrice := func(currency models.Currency) decimal.Decimal {
+		if price, ok := mockUSDPrices[currency]; ok {
+			return price
+		}
+		return decimal.NewFromInt(100)
+	}
+
+	base, quote, _ := splitSymbol(symbol)
+	return usdPrice(base).Div(usdPrice(quote))
+}
+
 // generateMockQuotes generates mock quotes for testing
-func (s *Service) generateMockQuotes(ctx context.Context) {
+func (s *Service) generateMockQuotes(ctx context.Context, symbols []models.Symbol) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	// Initial prices
-	btcPrice := decimal.NewFromFloat(60000.0)
-	ethPrice := decimal.NewFromFloat(3000.0)
+	prices := make(map[models.Symbol]decimal.Decimal, len(symbols))
+	for _, symbol := range symbols {
+		prices[symbol] = mockStartPrice(symbol)
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Generate random price movements
-			btcChange := decimal.NewFromFloat(0.001).Mul(decimal.NewFromFloat(float64(time.Now().UnixNano()%100 - 50)))
-			ethChange := decimal.NewFromFloat(0.001).Mul(decimal.NewFromFloat(float64(time.Now().UnixNano()%100 - 50)))
-
-			btcPrice = btcPrice.Add(btcChange)
-			ethPrice = ethPrice.Add(ethChange)
-
-			// Ensure prices don't go negative
-			if btcPrice.LessThan(decimal.Zero) {
-				btcPrice = decimal.NewFromFloat(60000.0)
+			for _, symbol := range symbols {
+				// Generate random price movements of up to 0.005%
+				step := decimal.NewFromFloat(float64(time.Now().UnixNano()%100-50) / 1000000)
+				price := prices[symbol].Add(prices[symbol].Mul(step))
+
+				// Ensure prices don't go negative
+				if price.LessThanOrEqual(decimal.Zero) {
+					price = mockStartPrice(symbol)
+				}
+				prices[symbol] = price
+
+				// Create quotes with bid/ask spread
+				spread := decimal.NewFromFloat(0.0001) // 0.01% spread
+
+				// Publish to Redis
+				s.publishQuote(&models.Quote{
+					Symbol: symbol,
+					Bid:    price.Sub(price.Mul(spread)),
+					Ask:    price.Add(price.Mul(spread)),
+					TS:     time.Now(),
+				})
 			}
-			if ethPrice.LessThan(decimal.Zero) {
-				ethPrice = decimal.NewFromFloat(3000.0)
-			}
-
-			// Create quotes with bid/ask spread
-			spread := decimal.NewFromFloat(0.0001) // 0.01% spread
-
-			btcQuote := &models.Quote{
-				Symbol: models.SymbolBTCUSD,
-				Bid:    btcPrice.Sub(btcPrice.Mul(spread)),
-				Ask:    btcPrice.Add(btcPrice.Mul(spread)),
-				TS:     time.Now(),
-			}
-
-			ethQuote := &models.Quote{
-				Symbol: models.SymbolETHUSD,
-				Bid:    ethPrice.Sub(ethPrice.Mul(spread)),
-				Ask:    ethPrice.Add(ethPrice.Mul(spread)),
-				TS:     time.Now(),
-			}
-
-			// Publish to Redis
-			s.publishQuote(btcQuote)
-			s.publishQuote(ethQuote)
 		}
 	}
 }
@@ -0,0 +1,74 @@
+package quotes
+
+import (
+	"sort"
+	"strings"
+
+	"microcoin/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// USDRates returns the USD value of one unit of every currency that can be reached
+// from USD by chaining the mid prices of BASE-QUOTE symbols, e.g. ETH through ETH-BTC
+// and BTC-USD when there is no ETH-USD mid. Currencies with no chain are left out.
+func USDRates(mids map[models.Symbol]decimal.Decimal) map[models.Currency]decimal.Decimal {
+	rates := map[models.Currency]decimal.Decimal{models.CurrencyUSD: decimal.NewFromInt(1)}
+
+	symbols := make([]models.Symbol, 0, len(mids))
+	for symbol := range mids {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+	// Direct USD quotes win over longer chains, so each pass only extends the
+	// currencies valued by the previous one; ties go to the first symbol
+	for {
+		found := make(map[models.Currency]decimal.Decimal)
+		for _, symbol := range symbols {
+			mid := mids[symbol]
+			if !mid.IsPositive() {
+				continue
+			}
+			base, quote, ok := splitSymbol(symbol)
+			if !ok {
+				continue
+			}
+
+			baseRate, baseKnown := rates[base]
+			quoteRate, quoteKnown := rates[quote]
+			switch {
+			case quoteKnown && !baseKnown:
+				if _, exists := found[base]; !exists {
+					found[base] = mid.Mul(quoteRate)
+				}
+			case baseKnown && !quoteKnown:
+				if _, exists := found[quote]; !exists {
+					found[quote] = baseRate.Div(mid)
+				}
+			}
+		}
+
+		if len(found) == 0 {
+			return rates
+		}
+		for currency, rate := range found {
+			rates[currency] = rate
+		}
+	}
+}
+
+// splitSymbol returns the base and quote currency of a BASE-QUOTE symbol
+func splitSymbol(symbol models.Symbol) (models.Currency, models.Currency, bool) {
+	base, quote, ok := strings.Cut(string(symbol), "-")
+	return models.Currency(base), models.Currency(quote), ok
+}
+
+// Mids returns the mid price of every symbol with a quote
+func (s *Service) Mids() map[models.Symbol]decimal.Decimal {
+	mids := make(map[models.Symbol]decimal.Decimal)
+	for _, quote := range s.GetQuotes() {
+		mids[quote.Symbol] = quote.Bid.Add(quote.Ask).Div(decimal.NewFromInt(2))
+	}
+	return mids
+}
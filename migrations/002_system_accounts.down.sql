@@ -0,0 +1,9 @@
+-- Drop system accounts and their entries
+DELETE FROM ledger_entries WHERE account_id IN (SELECT id FROM accounts WHERE user_id IS NULL);
+DELETE FROM accounts WHERE user_id IS NULL;
+
+-- Restore user-only accounts
+DROP INDEX IF EXISTS accounts_system_code_currency_key;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_owner_check;
+ALTER TABLE accounts DROP COLUMN IF EXISTS system_code;
+ALTER TABLE accounts ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,23 @@
+-- System accounts (chart of accounts) have no owning user and are identified by a code
+ALTER TABLE accounts ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE accounts ADD COLUMN system_code TEXT;
+ALTER TABLE accounts ADD CONSTRAINT accounts_owner_check
+  CHECK ((user_id IS NULL) <> (system_code IS NULL));
+
+CREATE UNIQUE INDEX accounts_system_code_currency_key
+  ON accounts (system_code, currency)
+  WHERE system_code IS NOT NULL;
+
+-- EQUITY:       paper money issued by top-ups (offsets every user deposit)
+-- FEE_REVENUE:  trading fees collected by the exchange
+-- MM_INVENTORY: simulated market-maker inventory used for quote fills
+INSERT INTO accounts (system_code, currency) VALUES
+  ('EQUITY', 'USD'),
+  ('EQUITY', 'BTC'),
+  ('EQUITY', 'ETH'),
+  ('FEE_REVENUE', 'USD'),
+  ('FEE_REVENUE', 'BTC'),
+  ('FEE_REVENUE', 'ETH'),
+  ('MM_INVENTORY', 'USD'),
+  ('MM_INVENTORY', 'BTC'),
+  ('MM_INVENTORY', 'ETH');
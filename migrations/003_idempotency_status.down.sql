@@ -0,0 +1,4 @@
+-- Drop idempotency key lifecycle columns
+DROP INDEX IF EXISTS idempotency_keys_expires_at_idx;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS status;
@@ -0,0 +1,7 @@
+-- Idempotency keys are claimed as IN_PROGRESS before the business operation runs
+-- and completed with the response in the same transaction as its effect
+ALTER TABLE idempotency_keys
+  ADD COLUMN status TEXT NOT NULL DEFAULT 'COMPLETED' CHECK (status IN ('IN_PROGRESS', 'COMPLETED')),
+  ADD COLUMN expires_at TIMESTAMPTZ NOT NULL DEFAULT NOW() + INTERVAL '24 hours';
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
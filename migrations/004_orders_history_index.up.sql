@@ -0,0 +1,2 @@
+-- Keyset pagination of a user's order history on (created_at, id)
+CREATE INDEX orders_user_created_at_id_idx ON orders (user_id, created_at DESC, id DESC);
@@ -0,0 +1,21 @@
+-- Fills produced by the matching engine, one row per taker/maker match
+CREATE TABLE trades (
+  id UUID PRIMARY KEY,
+  symbol TEXT NOT NULL,
+  side order_side NOT NULL,     -- taker side
+  price NUMERIC(30,10) NOT NULL,
+  qty NUMERIC(30,10) NOT NULL,
+  taker_order_id UUID NOT NULL REFERENCES orders(id),
+  maker_order_id UUID NOT NULL REFERENCES orders(id),
+  taker_user_id UUID NOT NULL REFERENCES users(id),
+  maker_user_id UUID NOT NULL REFERENCES users(id),
+  taker_fee NUMERIC(30,10) NOT NULL DEFAULT 0,
+  maker_fee NUMERIC(30,10) NOT NULL DEFAULT 0,
+  fee_currency currency NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX trades_taker_order_id_idx ON trades (taker_order_id);
+CREATE INDEX trades_maker_order_id_idx ON trades (maker_order_id);
+CREATE INDEX trades_taker_user_id_created_at_idx ON trades (taker_user_id, created_at DESC);
+CREATE INDEX trades_maker_user_id_created_at_idx ON trades (maker_user_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Drop liquidity provider trades and require a maker again
+DELETE FROM trades WHERE maker_order_id IS NULL OR maker_user_id IS NULL;
+ALTER TABLE trades ALTER COLUMN maker_user_id SET NOT NULL;
+ALTER TABLE trades ALTER COLUMN maker_order_id SET NOT NULL;
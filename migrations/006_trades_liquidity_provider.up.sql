@@ -0,0 +1,4 @@
+-- Market order remainders fill against the simulated liquidity provider,
+-- which has neither a user nor a resting order
+ALTER TABLE trades ALTER COLUMN maker_order_id DROP NOT NULL;
+ALTER TABLE trades ALTER COLUMN maker_user_id DROP NOT NULL;
@@ -0,0 +1,6 @@
+-- Time an order joined the queue at its price level; amendments that lose
+-- priority move it to the back without changing created_at
+ALTER TABLE orders ADD COLUMN queued_at TIMESTAMPTZ;
+UPDATE orders SET queued_at = created_at;
+ALTER TABLE orders ALTER COLUMN queued_at SET NOT NULL;
+ALTER TABLE orders ALTER COLUMN queued_at SET DEFAULT NOW();
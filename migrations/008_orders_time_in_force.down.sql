@@ -0,0 +1,6 @@
+-- Enum values cannot be dropped, so EXPIRED stays on order_status
+DROP INDEX IF EXISTS orders_gtd_expires_at_idx;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_expires_at_check;
+ALTER TABLE orders DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS time_in_force;
+DROP TYPE IF EXISTS time_in_force;
@@ -0,0 +1,12 @@
+-- Time in force, with an expiry for good-till-date orders
+CREATE TYPE time_in_force AS ENUM ('GTC','IOC','FOK','GTD');
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'EXPIRED';
+
+ALTER TABLE orders ADD COLUMN time_in_force time_in_force NOT NULL DEFAULT 'GTC';
+ALTER TABLE orders ADD COLUMN expires_at TIMESTAMPTZ;
+ALTER TABLE orders ADD CONSTRAINT orders_expires_at_check
+  CHECK ((time_in_force = 'GTD') = (expires_at IS NOT NULL));
+
+-- The expirer scans open GTD orders by expiry
+CREATE INDEX orders_gtd_expires_at_idx ON orders (expires_at)
+  WHERE time_in_force = 'GTD' AND status IN ('NEW', 'PARTIALLY_FILLED');
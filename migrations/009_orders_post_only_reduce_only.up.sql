@@ -0,0 +1,3 @@
+-- Post-only orders never take liquidity; reduce-only sells never exceed the position
+ALTER TABLE orders ADD COLUMN post_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE orders ADD COLUMN reduce_only BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+-- Enum values cannot be dropped, so STOP_MARKET and STOP_LIMIT stay on order_type
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_stop_price_check;
+ALTER TABLE orders DROP COLUMN IF EXISTS triggered_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS stop_price;
@@ -0,0 +1,11 @@
+-- Stop orders wait untriggered until the quote crosses stop_price, then go live
+ALTER TYPE order_type ADD VALUE IF NOT EXISTS 'STOP_MARKET';
+ALTER TYPE order_type ADD VALUE IF NOT EXISTS 'STOP_LIMIT';
+
+ALTER TABLE orders ADD COLUMN stop_price NUMERIC(30,10);
+ALTER TABLE orders ADD COLUMN triggered_at TIMESTAMPTZ;
+
+-- New enum values cannot be referenced in the transaction that adds them, so
+-- the type is compared as text
+ALTER TABLE orders ADD CONSTRAINT orders_stop_price_check
+  CHECK ((type::text LIKE 'STOP_%') = (stop_price IS NOT NULL));
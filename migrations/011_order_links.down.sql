@@ -0,0 +1,3 @@
+-- Enum values cannot be dropped, so PENDING stays on order_status
+DROP TABLE IF EXISTS order_links;
+DROP TYPE IF EXISTS order_link_role;
@@ -0,0 +1,13 @@
+-- Bracket orders: an entry order and its take-profit and stop-loss children share
+-- a group keyed by the entry order. Children wait as PENDING until the entry fills.
+CREATE TYPE order_link_role AS ENUM ('PARENT','TAKE_PROFIT','STOP_LOSS');
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'PENDING';
+
+CREATE TABLE order_links (
+  order_id UUID PRIMARY KEY REFERENCES orders(id),
+  group_id UUID NOT NULL REFERENCES orders(id),
+  role order_link_role NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX order_links_group_id_idx ON order_links (group_id);
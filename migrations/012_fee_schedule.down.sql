@@ -0,0 +1,2 @@
+ALTER TABLE trades DROP COLUMN IF EXISTS maker_fee_currency;
+DROP TABLE IF EXISTS fee_tiers;
@@ -0,0 +1,17 @@
+-- Maker/taker fees in basis points, tiered by a user's 30-day traded volume in USD
+CREATE TABLE fee_tiers (
+  min_volume NUMERIC(30,10) PRIMARY KEY CHECK (min_volume >= 0),
+  maker_bps NUMERIC(10,4) NOT NULL CHECK (maker_bps >= 0),
+  taker_bps NUMERIC(10,4) NOT NULL CHECK (taker_bps >= 0)
+);
+
+INSERT INTO fee_tiers (min_volume, maker_bps, taker_bps) VALUES
+  (0, 10, 20),
+  (100000, 8, 16),
+  (1000000, 5, 10);
+
+-- Each side pays its fee in the currency it receives, so the maker's currency can
+-- differ from the taker's; fee_currency stays the taker's
+ALTER TABLE trades ADD COLUMN maker_fee_currency currency;
+UPDATE trades SET maker_fee_currency = fee_currency;
+ALTER TABLE trades ALTER COLUMN maker_fee_currency SET NOT NULL;
@@ -0,0 +1,40 @@
+-- Dropping the function drops its trigger on currencies with it
+DROP FUNCTION IF EXISTS create_currency_accounts() CASCADE;
+
+CREATE OR REPLACE FUNCTION create_user_accounts()
+RETURNS TRIGGER AS $$
+BEGIN
+  INSERT INTO accounts (user_id, currency) VALUES
+    (NEW.id, 'USD'),
+    (NEW.id, 'BTC'),
+    (NEW.id, 'ETH');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_symbol_fkey;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_symbol_fkey;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_symbol_check;
+ALTER TABLE orders ADD CONSTRAINT orders_symbol_check CHECK (symbol IN ('BTC-USD','ETH-USD'));
+DROP TABLE IF EXISTS instruments;
+DROP TYPE IF EXISTS instrument_status;
+
+-- Restore the currency enum; rows in currencies other than USD, BTC and ETH must be
+-- removed before rolling back
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'currency') THEN
+    CREATE TYPE currency AS ENUM ('USD', 'BTC', 'ETH');
+  END IF;
+END
+$$;
+
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_maker_fee_currency_fkey;
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_fee_currency_fkey;
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_currency_fkey;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_currency_fkey;
+ALTER TABLE accounts ALTER COLUMN currency TYPE currency USING currency::currency;
+ALTER TABLE ledger_entries ALTER COLUMN currency TYPE currency USING currency::currency;
+ALTER TABLE trades ALTER COLUMN fee_currency TYPE currency USING fee_currency::currency;
+ALTER TABLE trades ALTER COLUMN maker_fee_currency TYPE currency USING maker_fee_currency::currency;
+DROP TABLE IF EXISTS currencies;
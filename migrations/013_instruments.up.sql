@@ -0,0 +1,76 @@
+-- Currencies and instruments are data: listing SOL-USD or ETH-BTC is an insert
+CREATE TABLE currencies (
+  code TEXT PRIMARY KEY CHECK (code ~ '^[A-Z0-9]+$'),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO currencies (code) VALUES ('USD'), ('BTC'), ('ETH');
+
+-- Currency columns reference the currencies table instead of the enum
+ALTER TABLE accounts ALTER COLUMN currency TYPE TEXT;
+ALTER TABLE accounts ADD CONSTRAINT accounts_currency_fkey
+  FOREIGN KEY (currency) REFERENCES currencies(code);
+ALTER TABLE ledger_entries ALTER COLUMN currency TYPE TEXT;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_currency_fkey
+  FOREIGN KEY (currency) REFERENCES currencies(code);
+ALTER TABLE trades ALTER COLUMN fee_currency TYPE TEXT;
+ALTER TABLE trades ALTER COLUMN maker_fee_currency TYPE TEXT;
+ALTER TABLE trades ADD CONSTRAINT trades_fee_currency_fkey
+  FOREIGN KEY (fee_currency) REFERENCES currencies(code);
+ALTER TABLE trades ADD CONSTRAINT trades_maker_fee_currency_fkey
+  FOREIGN KEY (maker_fee_currency) REFERENCES currencies(code);
+DROP TYPE currency;
+
+-- HALTED instruments keep their books but accept no new orders
+CREATE TYPE instrument_status AS ENUM ('TRADING', 'HALTED');
+
+CREATE TABLE instruments (
+  symbol TEXT PRIMARY KEY,
+  base_currency TEXT NOT NULL REFERENCES currencies(code),
+  quote_currency TEXT NOT NULL REFERENCES currencies(code),
+  tick_size NUMERIC(30,10) NOT NULL CHECK (tick_size > 0),
+  lot_size NUMERIC(30,10) NOT NULL CHECK (lot_size > 0),
+  min_notional NUMERIC(30,10) NOT NULL DEFAULT 0 CHECK (min_notional >= 0), -- in the quote currency
+  status instrument_status NOT NULL DEFAULT 'TRADING',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (base_currency <> quote_currency),
+  CHECK (symbol = base_currency || '-' || quote_currency)
+);
+
+INSERT INTO instruments (symbol, base_currency, quote_currency, tick_size, lot_size, min_notional) VALUES
+  ('BTC-USD', 'BTC', 'USD', 0.01, 0.00001, 1),
+  ('ETH-USD', 'ETH', 'USD', 0.01, 0.0001, 1);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_symbol_check;
+ALTER TABLE orders ADD CONSTRAINT orders_symbol_fkey
+  FOREIGN KEY (symbol) REFERENCES instruments(symbol);
+ALTER TABLE trades ADD CONSTRAINT trades_symbol_fkey
+  FOREIGN KEY (symbol) REFERENCES instruments(symbol);
+
+-- Users get an account in every listed currency
+CREATE OR REPLACE FUNCTION create_user_accounts()
+RETURNS TRIGGER AS $$
+BEGIN
+  INSERT INTO accounts (user_id, currency)
+  SELECT NEW.id, code FROM currencies;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Listing a currency opens it for every user and every system account
+CREATE OR REPLACE FUNCTION create_currency_accounts()
+RETURNS TRIGGER AS $$
+BEGIN
+  INSERT INTO accounts (user_id, currency)
+  SELECT id, NEW.code FROM users;
+
+  INSERT INTO accounts (system_code, currency)
+  SELECT DISTINCT system_code, NEW.code FROM accounts WHERE system_code IS NOT NULL;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER create_currency_accounts_trigger
+  AFTER INSERT ON currencies
+  FOR EACH ROW
+  EXECUTE FUNCTION create_currency_accounts();
@@ -0,0 +1,2 @@
+DELETE FROM instruments WHERE symbol = 'ETH-BTC';
+ALTER TABLE trades DROP COLUMN IF EXISTS notional_usd;
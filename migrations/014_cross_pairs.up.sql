@@ -0,0 +1,7 @@
+-- Cross pairs quote in currencies other than USD, so each trade records its USD
+-- value at execution for fee tier volume
+ALTER TABLE trades ADD COLUMN notional_usd NUMERIC(30,10) NOT NULL DEFAULT 0 CHECK (notional_usd >= 0);
+UPDATE trades SET notional_usd = price * qty WHERE symbol LIKE '%-USD';
+
+INSERT INTO instruments (symbol, base_currency, quote_currency, tick_size, lot_size, min_notional) VALUES
+  ('ETH-BTC', 'ETH', 'BTC', 0.00001, 0.0001, 0.0001);
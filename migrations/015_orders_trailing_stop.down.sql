@@ -0,0 +1,8 @@
+-- Enum values cannot be dropped, so TRAILING_STOP stays on order_type. Existing
+-- trailing stops would fail the original stop price check, so it is not validated.
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_trail_check;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_stop_price_check;
+ALTER TABLE orders DROP COLUMN IF EXISTS trail_percent;
+ALTER TABLE orders DROP COLUMN IF EXISTS trail_offset;
+ALTER TABLE orders ADD CONSTRAINT orders_stop_price_check
+  CHECK ((type::text LIKE 'STOP_%') = (stop_price IS NOT NULL)) NOT VALID;
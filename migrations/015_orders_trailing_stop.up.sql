@@ -0,0 +1,16 @@
+-- Trailing stops carry a stop_price that follows the quote by a fixed offset or a
+-- percentage, ratcheting only in the order's favor, then go live as market orders
+ALTER TYPE order_type ADD VALUE IF NOT EXISTS 'TRAILING_STOP';
+
+ALTER TABLE orders ADD COLUMN trail_offset NUMERIC(30,10) CHECK (trail_offset > 0);
+ALTER TABLE orders ADD COLUMN trail_percent NUMERIC(10,4) CHECK (trail_percent > 0 AND trail_percent < 100);
+
+-- New enum values cannot be referenced in the transaction that adds them, so
+-- the type is compared as text
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_stop_price_check;
+ALTER TABLE orders ADD CONSTRAINT orders_stop_price_check
+  CHECK ((type::text IN ('STOP_MARKET', 'STOP_LIMIT', 'TRAILING_STOP')) = (stop_price IS NOT NULL));
+
+-- A trailing stop trails by exactly one of an offset or a percentage
+ALTER TABLE orders ADD CONSTRAINT orders_trail_check
+  CHECK ((type::text = 'TRAILING_STOP') = ((trail_offset IS NULL) <> (trail_percent IS NULL)));
@@ -0,0 +1,3 @@
+-- Iceberg limit orders show display_qty at a time and requeue at the back of their
+-- level each time a slice fills
+ALTER TABLE orders ADD COLUMN display_qty NUMERIC(30,10) CHECK (display_qty > 0);
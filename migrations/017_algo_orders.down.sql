@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS algo_slices;
+DROP TABLE IF EXISTS algo_orders;
+DROP TYPE IF EXISTS algo_status;
+DROP TYPE IF EXISTS algo_strategy;
@@ -0,0 +1,38 @@
+-- Algo parent orders slice a quantity into market child orders over a duration,
+-- evenly (TWAP) or by a volume profile (VWAP)
+CREATE TYPE algo_strategy AS ENUM ('TWAP','VWAP');
+CREATE TYPE algo_status AS ENUM ('RUNNING','COMPLETED','EXPIRED','CANCELED');
+
+CREATE TABLE algo_orders (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id),
+  symbol TEXT NOT NULL REFERENCES instruments(symbol),
+  side order_side NOT NULL,
+  strategy algo_strategy NOT NULL,
+  qty NUMERIC(30,10) NOT NULL CHECK (qty > 0),
+  limit_price NUMERIC(30,10) CHECK (limit_price > 0),
+  arrival_price NUMERIC(30,10) NOT NULL CHECK (arrival_price > 0),
+  status algo_status NOT NULL DEFAULT 'RUNNING',
+  start_at TIMESTAMPTZ NOT NULL,
+  end_at TIMESTAMPTZ NOT NULL CHECK (end_at > start_at),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX algo_orders_user_created_at_idx ON algo_orders (user_id, created_at DESC);
+CREATE INDEX algo_orders_running_idx ON algo_orders (status) WHERE status = 'RUNNING';
+
+-- Each slice is due at due_at and brings the parent's cumulative fills up to
+-- target_qty. Overdue slices are folded into the latest due one.
+CREATE TABLE algo_slices (
+  algo_id UUID NOT NULL REFERENCES algo_orders(id),
+  slice INT NOT NULL CHECK (slice > 0),
+  due_at TIMESTAMPTZ NOT NULL,
+  target_qty NUMERIC(30,10) NOT NULL CHECK (target_qty >= 0),
+  order_id UUID REFERENCES orders(id),
+  submitted_at TIMESTAMPTZ,
+  error TEXT,
+  PRIMARY KEY (algo_id, slice)
+);
+
+CREATE INDEX algo_slices_order_id_idx ON algo_slices (order_id);
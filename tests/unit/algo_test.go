@@ -0,0 +1,52 @@
+package unit
+
+import (
+	"testing"
+
+	"microcoin/internal/algo"
+	"microcoin/internal/models"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decimals(values ...string) []decimal.Decimal {
+	result := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		result[i] = decimal.RequireFromString(value)
+	}
+	return result
+}
+
+func assertTargets(t *testing.T, expected []string, targets []decimal.Decimal) {
+	t.Helper()
+	require.Len(t, targets, len(expected))
+	for i, target := range targets {
+		assert.True(t, target.Equal(decimal.RequireFromString(expected[i])), "slice %d: expected %s, got %s", i+1, expected[i], target)
+	}
+}
+
+func TestScheduleTWAP(t *testing.T) {
+	// Thirds of 1 BTC round down to the 0.0001 lot and carry into the last slice
+	targets := algo.Schedule(decimal.RequireFromString("1"), algo.EvenWeights(3), decimal.RequireFromString("0.0001"))
+	assertTargets(t, []string{"0.3333", "0.6666", "1"}, targets)
+}
+
+func TestScheduleVWAP(t *testing.T) {
+	targets := algo.Schedule(decimal.RequireFromString("2"), decimals("1", "0", "3"), decimal.RequireFromString("0.1"))
+	assertTargets(t, []string{"0.5", "0.5", "2"}, targets)
+
+	// A profile with no volume falls back to even slices
+	targets = algo.Schedule(decimal.RequireFromString("2"), decimals("0", "0"), decimal.RequireFromString("0.1"))
+	assertTargets(t, []string{"1", "2"}, targets)
+}
+
+func TestSlippage(t *testing.T) {
+	arrival := decimal.RequireFromString("50000")
+	worse := decimal.RequireFromString("50050")
+
+	// Buying above the arrival price costs, selling above it gains
+	assert.True(t, algo.Slippage(models.OrderSideBuy, arrival, worse).Equal(decimal.NewFromInt(10)))
+	assert.True(t, algo.Slippage(models.OrderSideSell, arrival, worse).Equal(decimal.NewFromInt(-10)))
+}
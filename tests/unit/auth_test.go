@@ -1,6 +1,8 @@
 package unit
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"microcoin/internal/auth"
@@ -96,3 +98,29 @@ func TestPasswordStrength(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminMiddleware(t *testing.T) {
+	handler := auth.AdminMiddleware("test-admin-key")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/reconcile", nil)
+		if key != "" {
+			req.Header.Set("X-Admin-Key", key)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("test-admin-key"))
+	assert.Equal(t, http.StatusForbidden, request("wrong-key"))
+	assert.Equal(t, http.StatusForbidden, request(""))
+
+	// Without a configured key nothing gets through, not even an empty header
+	unconfigured := auth.AdminMiddleware("")(handler)
+	recorder := httptest.NewRecorder()
+	unconfigured.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/reconcile", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
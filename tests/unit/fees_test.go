@@ -0,0 +1,79 @@
+package unit
+
+import (
+	"testing"
+
+	"microcoin/internal/fees"
+	"microcoin/internal/models"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func feeTier(minVolume, makerBps, takerBps int64) models.FeeTier {
+	return models.FeeTier{
+		MinVolume: decimal.NewFromInt(minVolume),
+		MakerBps:  decimal.NewFromInt(makerBps),
+		TakerBps:  decimal.NewFromInt(takerBps),
+	}
+}
+
+func TestFeeScheduleTiers(t *testing.T) {
+	// Tiers are sorted regardless of the order they are given in
+	schedule, err := fees.NewSchedule([]models.FeeTier{
+		feeTier(1000000, 5, 10),
+		feeTier(0, 10, 20),
+		feeTier(100000, 8, 16),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		volume   int64
+		takerBps int64
+	}{
+		{0, 20},
+		{99999, 20},
+		{100000, 16},
+		{999999, 16},
+		{5000000, 10},
+	}
+	for _, tt := range tests {
+		tier := schedule.TierFor(decimal.NewFromInt(tt.volume))
+		assert.True(t, tier.TakerBps.Equal(decimal.NewFromInt(tt.takerBps)), "volume %d", tt.volume)
+	}
+
+	// The default schedule matches the tiers seeded by the migration
+	defaults := fees.DefaultSchedule().Tiers()
+	require.Len(t, defaults, 3)
+	for i, tier := range schedule.Tiers() {
+		assert.True(t, tier.MinVolume.Equal(defaults[i].MinVolume))
+		assert.True(t, tier.MakerBps.Equal(defaults[i].MakerBps))
+		assert.True(t, tier.TakerBps.Equal(defaults[i].TakerBps))
+	}
+}
+
+func TestFeeScheduleValidation(t *testing.T) {
+	_, err := fees.NewSchedule(nil)
+	assert.Error(t, err)
+
+	// The lowest tier must cover new users
+	_, err = fees.NewSchedule([]models.FeeTier{feeTier(100, 10, 20)})
+	assert.Error(t, err)
+
+	_, err = fees.NewSchedule([]models.FeeTier{feeTier(0, 10, 20), feeTier(0, 5, 10)})
+	assert.Error(t, err)
+
+	_, err = fees.NewSchedule([]models.FeeTier{feeTier(0, -1, 20)})
+	assert.Error(t, err)
+}
+
+func TestFeeAmount(t *testing.T) {
+	assert.True(t, fees.Fee(decimal.NewFromInt(1500), decimal.NewFromInt(10)).Equal(decimal.NewFromFloat(1.5)))
+	assert.True(t, fees.Fee(decimal.NewFromFloat(0.5), decimal.NewFromInt(20)).Equal(decimal.NewFromFloat(0.001)))
+	assert.True(t, fees.Fee(decimal.NewFromInt(100), decimal.Zero).IsZero())
+
+	// Fees round to the ledger's ten decimal places
+	fee := fees.Fee(decimal.New(1, -10), decimal.NewFromInt(15))
+	assert.True(t, fee.IsZero(), "fee %s", fee)
+}
@@ -0,0 +1,69 @@
+package unit
+
+import (
+	"testing"
+
+	"microcoin/internal/instruments"
+	"microcoin/internal/models"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func instrument(symbol models.Symbol, base, quote models.Currency) models.Instrument {
+	return models.Instrument{
+		Symbol:        symbol,
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		TickSize:      decimal.New(1, -2),
+		LotSize:       decimal.New(1, -4),
+		Status:        models.InstrumentStatusTrading,
+	}
+}
+
+func TestInstrumentRegistry(t *testing.T) {
+	registry := instruments.NewRegistry([]models.Instrument{
+		instrument(models.SymbolBTCUSD, models.CurrencyBTC, models.CurrencyUSD),
+		instrument("ETH-BTC", models.CurrencyETH, models.CurrencyBTC),
+		instrument(models.SymbolBTCUSD, models.CurrencyBTC, "EUR"),
+	})
+
+	// Duplicates keep the first listing
+	assert.Equal(t, []models.Symbol{models.SymbolBTCUSD, "ETH-BTC"}, registry.Symbols())
+	require.Len(t, registry.List(), 2)
+
+	btcUSD, err := registry.Get(models.SymbolBTCUSD)
+	require.NoError(t, err)
+	assert.Equal(t, models.CurrencyUSD, btcUSD.QuoteCurrency)
+
+	ethBTC, err := registry.Get("ETH-BTC")
+	require.NoError(t, err)
+	assert.Equal(t, models.CurrencyETH, ethBTC.BaseCurrency)
+	assert.Equal(t, models.CurrencyBTC, ethBTC.QuoteCurrency)
+
+	_, err = registry.Get("SOL-USD")
+	assert.ErrorIs(t, err, instruments.ErrUnknownSymbol)
+
+	// Callers cannot reorder the registry through the returned slice
+	symbols := registry.Symbols()
+	symbols[0] = "SOL-USD"
+	assert.Equal(t, models.SymbolBTCUSD, registry.Symbols()[0])
+}
+
+func TestInstrumentRules(t *testing.T) {
+	btcUSD := instrument(models.SymbolBTCUSD, models.CurrencyBTC, models.CurrencyUSD)
+	btcUSD.LotSize = decimal.New(1, -5)
+	btcUSD.MinNotional = decimal.NewFromInt(10)
+
+	assert.NoError(t, instruments.CheckPrice(&btcUSD, decimal.RequireFromString("60000.01")))
+	// Trailing zeros do not make a price a different level
+	assert.NoError(t, instruments.CheckPrice(&btcUSD, decimal.RequireFromString("60000.000")))
+	assert.ErrorIs(t, instruments.CheckPrice(&btcUSD, decimal.RequireFromString("60000.005")), instruments.ErrInvalidTickSize)
+
+	assert.NoError(t, instruments.CheckQty(&btcUSD, decimal.RequireFromString("0.00123")))
+	assert.ErrorIs(t, instruments.CheckQty(&btcUSD, decimal.RequireFromString("0.000015")), instruments.ErrInvalidLotSize)
+
+	assert.NoError(t, instruments.CheckNotional(&btcUSD, decimal.NewFromInt(1000), decimal.RequireFromString("0.01")))
+	assert.ErrorIs(t, instruments.CheckNotional(&btcUSD, decimal.NewFromInt(1000), decimal.RequireFromString("0.00999")), instruments.ErrBelowMinNotional)
+}
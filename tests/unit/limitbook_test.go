@@ -0,0 +1,497 @@
+package unit
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"microcoin/internal/limitbook"
+	"microcoin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBookOrder(side models.OrderSide, price *decimal.Decimal, qty int64, createdAt time.Time) *limitbook.Order {
+	orderType := models.OrderTypeLimit
+	if price == nil {
+		orderType = models.OrderTypeMarket
+	}
+
+	return &limitbook.Order{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		Symbol:    models.SymbolBTCUSD,
+		Side:      side,
+		Type:      orderType,
+		Price:     price,
+		Qty:       decimal.NewFromInt(qty),
+		FilledQty: decimal.Zero,
+		Status:    models.OrderStatusNew,
+		CreatedAt: createdAt,
+	}
+}
+
+func priceOf(value int64) *decimal.Decimal {
+	price := decimal.NewFromInt(value)
+	return &price
+}
+
+func TestBookSideDirection(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+
+	for _, price := range []int64{100, 102, 98} {
+		book.AddOrder(newBookOrder(models.OrderSideBuy, priceOf(price), 1, now))
+		book.AddOrder(newBookOrder(models.OrderSideSell, priceOf(price+10), 1, now))
+	}
+
+	bestBid, ok := book.GetBestBid()
+	require.True(t, ok)
+	assert.True(t, bestBid.Equal(decimal.NewFromInt(102)))
+
+	bestAsk, ok := book.GetBestAsk()
+	require.True(t, ok)
+	assert.True(t, bestAsk.Equal(decimal.NewFromInt(108)))
+}
+
+func TestBookSideLevelRemoval(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+
+	first := newBookOrder(models.OrderSideSell, priceOf(100), 1, now)
+	second := newBookOrder(models.OrderSideSell, priceOf(100), 1, now.Add(time.Second))
+	worse := newBookOrder(models.OrderSideSell, priceOf(101), 1, now)
+	book.AddOrder(first)
+	book.AddOrder(second)
+	book.AddOrder(worse)
+	assert.Equal(t, 2, book.Asks.Depth())
+
+	// Time priority within the level
+	trades := book.MatchOrder(newBookOrder(models.OrderSideBuy, priceOf(100), 1, now))
+	require.Len(t, trades, 1)
+	assert.Equal(t, first.ID, trades[0].MakerOrderID)
+
+	_, found := book.Asks.GetOrder(first.ID)
+	assert.False(t, found)
+
+	// Removing the last order drops the level so the next one becomes best
+	removed, ok := book.RemoveOrder(second.ID)
+	require.True(t, ok)
+	assert.Equal(t, second.ID, removed.ID)
+	assert.Equal(t, 1, book.Asks.Depth())
+
+	bestAsk, ok := book.GetBestAsk()
+	require.True(t, ok)
+	assert.True(t, bestAsk.Equal(decimal.NewFromInt(101)))
+
+	// A buy through an emptied level terminates instead of spinning on it
+	taker := newBookOrder(models.OrderSideBuy, priceOf(105), 3, now)
+	trades = book.MatchOrder(taker)
+	require.Len(t, trades, 1)
+	assert.Equal(t, models.OrderStatusPartiallyFilled, taker.Status)
+	assert.Equal(t, 0, book.Asks.Len())
+	assert.Equal(t, 0, book.Asks.Depth())
+
+	_, ok = book.RemoveOrder(uuid.New())
+	assert.False(t, ok)
+}
+
+func TestFillableQty(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+
+	book.AddOrder(newBookOrder(models.OrderSideSell, priceOf(100), 2, now))
+	book.AddOrder(newBookOrder(models.OrderSideSell, priceOf(101), 3, now))
+	book.AddOrder(newBookOrder(models.OrderSideSell, priceOf(105), 4, now))
+
+	// Only levels the order crosses count, capped at its quantity
+	assert.True(t, book.FillableQty(newBookOrder(models.OrderSideBuy, priceOf(101), 10, now)).Equal(decimal.NewFromInt(5)))
+	assert.True(t, book.FillableQty(newBookOrder(models.OrderSideBuy, priceOf(105), 6, now)).Equal(decimal.NewFromInt(6)))
+	assert.True(t, book.FillableQty(newBookOrder(models.OrderSideBuy, priceOf(99), 1, now)).IsZero())
+	assert.True(t, book.FillableQty(newBookOrder(models.OrderSideBuy, nil, 20, now)).Equal(decimal.NewFromInt(9)))
+
+	// Checking does not touch the book
+	assert.Equal(t, 3, book.Asks.Len())
+	assert.True(t, book.FillableQty(newBookOrder(models.OrderSideSell, priceOf(1), 1, now)).IsZero())
+}
+
+// checkBookInvariants asserts the book matches the reference set of resting orders
+func checkBookInvariants(t *testing.T, book *limitbook.OrderBook, resting map[uuid.UUID]*limitbook.Order) {
+	t.Helper()
+
+	sides := map[models.OrderSide]*limitbook.BookSide{
+		models.OrderSideBuy:  book.Bids,
+		models.OrderSideSell: book.Asks,
+	}
+
+	for side, bookSide := range sides {
+		var best *limitbook.Order
+		prices := make(map[string]bool)
+		count := 0
+
+		for _, order := range resting {
+			if order.Side != side {
+				continue
+			}
+			count++
+			prices[order.Price.String()] = true
+
+			found, ok := bookSide.GetOrder(order.ID)
+			require.True(t, ok, "resting order missing from book")
+			require.Same(t, order, found)
+			require.True(t, order.FilledQty.LessThan(order.Qty))
+
+			better := best == nil ||
+				(side == models.OrderSideBuy && order.Price.GreaterThan(*best.Price)) ||
+				(side == models.OrderSideSell && order.Price.LessThan(*best.Price)) ||
+				(order.Price.Equal(*best.Price) && order.CreatedAt.Before(best.CreatedAt))
+			if better {
+				best = order
+			}
+		}
+
+		require.Equal(t, count, bookSide.Len())
+		require.Equal(t, len(prices), bookSide.Depth())
+
+		level, ok := bookSide.GetBestLevel()
+		if best == nil {
+			require.False(t, ok)
+			continue
+		}
+		require.True(t, ok)
+		require.NotEmpty(t, level.Orders)
+		require.True(t, level.Price.Equal(*best.Price))
+		require.Equal(t, best.ID, level.Orders[0].ID, "oldest order must be first in its level")
+	}
+
+	// Matching never leaves a crossed book
+	bestBid, hasBid := book.GetBestBid()
+	bestAsk, hasAsk := book.GetBestAsk()
+	if hasBid && hasAsk {
+		require.True(t, bestBid.LessThan(*bestAsk), "book is crossed")
+	}
+}
+
+func TestOrderBookProperties(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+		resting := make(map[uuid.UUID]*limitbook.Order)
+		now := time.Now()
+
+		for step := 0; step < 500; step++ {
+			now = now.Add(time.Millisecond)
+
+			// Cancel a random resting order now and then
+			if len(resting) > 0 && rng.Intn(4) == 0 {
+				for id := range resting {
+					removed, ok := book.RemoveOrder(id)
+					require.True(t, ok)
+					require.Equal(t, id, removed.ID)
+					delete(resting, id)
+					break
+				}
+				checkBookInvariants(t, book, resting)
+				continue
+			}
+
+			side := models.OrderSideBuy
+			if rng.Intn(2) == 0 {
+				side = models.OrderSideSell
+			}
+
+			var price *decimal.Decimal
+			if rng.Intn(10) > 0 {
+				price = priceOf(95 + rng.Int63n(11))
+			}
+			taker := newBookOrder(side, price, 1+rng.Int63n(5), now)
+
+			trades := book.MatchOrder(taker)
+
+			filled := decimal.Zero
+			for i, trade := range trades {
+				filled = filled.Add(trade.Qty)
+				require.True(t, trade.Qty.GreaterThan(decimal.Zero))
+
+				// Fills respect the limit and walk the book from the best price
+				if price != nil {
+					if side == models.OrderSideBuy {
+						require.True(t, trade.Price.LessThanOrEqual(*price))
+					} else {
+						require.True(t, trade.Price.GreaterThanOrEqual(*price))
+					}
+				}
+				if i > 0 {
+					if side == models.OrderSideBuy {
+						require.True(t, trade.Price.GreaterThanOrEqual(trades[i-1].Price))
+					} else {
+						require.True(t, trade.Price.LessThanOrEqual(trades[i-1].Price))
+					}
+				}
+
+				maker, ok := resting[trade.MakerOrderID]
+				require.True(t, ok, "trade against an order that is not resting")
+				require.NotEqual(t, side, maker.Side)
+				if maker.FilledQty.Equal(maker.Qty) {
+					require.Equal(t, models.OrderStatusFilled, maker.Status)
+					delete(resting, maker.ID)
+				}
+			}
+			require.True(t, filled.Equal(taker.FilledQty))
+			require.True(t, taker.FilledQty.LessThanOrEqual(taker.Qty))
+
+			// Limit orders rest their remainder like the order service does
+			if price != nil && taker.FilledQty.LessThan(taker.Qty) {
+				book.AddOrder(taker)
+				resting[taker.ID] = taker
+			}
+
+			checkBookInvariants(t, book, resting)
+		}
+	}
+}
+
+func newStopOrder(side models.OrderSide, stopPrice int64, createdAt time.Time) *limitbook.Order {
+	order := newBookOrder(side, nil, 1, createdAt)
+	order.Type = models.OrderTypeStopMarket
+	order.StopPrice = priceOf(stopPrice)
+	return order
+}
+
+func TestTriggerBook(t *testing.T) {
+	book := limitbook.NewTriggerBook(models.SymbolBTCUSD)
+	now := time.Now()
+
+	buyLate := newStopOrder(models.OrderSideBuy, 110, now.Add(time.Second))
+	buyEarly := newStopOrder(models.OrderSideBuy, 110, now)
+	buyFar := newStopOrder(models.OrderSideBuy, 120, now)
+	sellNear := newStopOrder(models.OrderSideSell, 95, now)
+	sellFar := newStopOrder(models.OrderSideSell, 90, now)
+	canceled := newStopOrder(models.OrderSideSell, 99, now)
+	for _, order := range []*limitbook.Order{buyLate, buyFar, buyEarly, sellFar, sellNear, canceled} {
+		book.AddStop(order)
+	}
+
+	removed, ok := book.RemoveStop(canceled.ID)
+	require.True(t, ok)
+	assert.Equal(t, canceled.ID, removed.ID)
+	_, ok = book.RemoveStop(canceled.ID)
+	assert.False(t, ok)
+
+	// A quote inside every stop triggers nothing
+	assert.Empty(t, book.Triggered(decimal.NewFromInt(99), decimal.NewFromInt(101)))
+	assert.Equal(t, 5, book.Len())
+
+	// The ask reaching 110 triggers both buy stops there, oldest first
+	triggered := book.Triggered(decimal.NewFromInt(105), decimal.NewFromInt(110))
+	require.Len(t, triggered, 2)
+	assert.Equal(t, buyEarly.ID, triggered[0].ID)
+	assert.Equal(t, buyLate.ID, triggered[1].ID)
+
+	// A bid falling through both sell stops triggers the nearer one first
+	triggered = book.Triggered(decimal.NewFromInt(85), decimal.NewFromInt(86))
+	require.Len(t, triggered, 2)
+	assert.Equal(t, sellNear.ID, triggered[0].ID)
+	assert.Equal(t, sellFar.ID, triggered[1].ID)
+
+	_, ok = book.GetStop(buyFar.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 1, book.Len())
+}
+
+func TestTrailingStopPrice(t *testing.T) {
+	tick := decimal.NewFromFloat(0.01)
+	bid, ask := decimal.NewFromInt(100), decimal.NewFromFloat(100.5)
+	offset := decimal.NewFromInt(5)
+	percent := decimal.NewFromFloat(2.5)
+
+	sell := limitbook.TrailingStopPrice(models.OrderSideSell, &offset, nil, bid, ask, tick)
+	assert.True(t, sell.Equal(decimal.NewFromInt(95)), "sell %s", sell)
+	buy := limitbook.TrailingStopPrice(models.OrderSideBuy, &offset, nil, bid, ask, tick)
+	assert.True(t, buy.Equal(decimal.NewFromFloat(105.5)), "buy %s", buy)
+
+	// Percentages round away from the quote to a whole tick
+	sell = limitbook.TrailingStopPrice(models.OrderSideSell, nil, &percent, decimal.NewFromFloat(100.01), ask, tick)
+	assert.True(t, sell.Equal(decimal.NewFromFloat(97.50)), "sell %s", sell)
+	buy = limitbook.TrailingStopPrice(models.OrderSideBuy, nil, &percent, bid, ask, tick)
+	assert.True(t, buy.Equal(decimal.NewFromFloat(103.02)), "buy %s", buy)
+}
+
+func TestTriggerBookTrail(t *testing.T) {
+	book := limitbook.NewTriggerBook(models.SymbolBTCUSD)
+	now := time.Now()
+	tick := decimal.NewFromInt(1)
+	offset := decimal.NewFromInt(5)
+
+	trailingSell := newStopOrder(models.OrderSideSell, 95, now)
+	trailingSell.TrailOffset = &offset
+	fixedSell := newStopOrder(models.OrderSideSell, 96, now)
+	trailingBuy := newStopOrder(models.OrderSideBuy, 106, now)
+	trailingBuy.TrailOffset = &offset
+	for _, order := range []*limitbook.Order{trailingSell, fixedSell, trailingBuy} {
+		book.AddStop(order)
+	}
+
+	// The bid rising drags the trailing sell up; fixed stops never move
+	moves := book.Trail(decimal.NewFromInt(110), decimal.NewFromInt(111), tick)
+	require.Len(t, moves, 1)
+	assert.Equal(t, trailingSell.ID, moves[0].Order.ID)
+	assert.True(t, moves[0].Previous.Equal(decimal.NewFromInt(95)))
+	assert.True(t, trailingSell.StopPrice.Equal(decimal.NewFromInt(105)))
+	assert.True(t, fixedSell.StopPrice.Equal(decimal.NewFromInt(96)))
+
+	// Falling back does not loosen it, and the ratcheted stop now triggers first
+	assert.Empty(t, book.Trail(decimal.NewFromInt(106), decimal.NewFromInt(107), tick))
+	triggered := book.Triggered(decimal.NewFromInt(104), decimal.NewFromInt(105))
+	require.Len(t, triggered, 1)
+	assert.Equal(t, trailingSell.ID, triggered[0].ID)
+
+	// The ask falling drags the trailing buy down
+	moves = book.Trail(decimal.NewFromInt(97), decimal.NewFromInt(98), tick)
+	require.Len(t, moves, 1)
+	assert.True(t, trailingBuy.StopPrice.Equal(decimal.NewFromInt(103)))
+
+	// Moving a stop back keeps the trigger order
+	require.True(t, book.MoveStop(trailingBuy.ID, decimal.NewFromInt(106)))
+	assert.Empty(t, book.Triggered(decimal.NewFromInt(97), decimal.NewFromInt(105)))
+}
+
+func TestIcebergMatching(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+
+	iceberg := newBookOrder(models.OrderSideSell, priceOf(100), 10, now)
+	display := decimal.NewFromInt(3)
+	iceberg.DisplayQty = &display
+	plain := newBookOrder(models.OrderSideSell, priceOf(100), 5, now.Add(time.Second))
+	book.AddOrder(iceberg)
+	book.AddOrder(plain)
+
+	// Only the iceberg's slice is visible
+	snapshot := book.Snapshot(0)
+	require.Len(t, snapshot.Asks, 1)
+	assert.True(t, snapshot.Asks[0].Qty.Equal(decimal.NewFromInt(8)))
+	assert.Equal(t, 2, snapshot.Asks[0].Orders)
+	assert.Empty(t, snapshot.Bids)
+
+	// Filling the slice sends the iceberg behind the plain order
+	trades := book.MatchOrder(newBookOrder(models.OrderSideBuy, priceOf(100), 4, now))
+	require.Len(t, trades, 2)
+	assert.Equal(t, iceberg.ID, trades[0].MakerOrderID)
+	assert.True(t, trades[0].Qty.Equal(decimal.NewFromInt(3)))
+	assert.Equal(t, plain.ID, trades[1].MakerOrderID)
+	assert.True(t, book.Snapshot(0).Asks[0].Qty.Equal(decimal.NewFromInt(7)))
+
+	// A large taker works through the plain order, then slice after slice
+	trades = book.MatchOrder(newBookOrder(models.OrderSideBuy, priceOf(100), 10, now))
+	require.Len(t, trades, 3)
+	assert.Equal(t, plain.ID, trades[0].MakerOrderID)
+	assert.Equal(t, iceberg.ID, trades[1].MakerOrderID)
+	assert.Equal(t, iceberg.ID, trades[2].MakerOrderID)
+	assert.True(t, iceberg.FilledQty.Equal(decimal.NewFromInt(9)))
+
+	snapshot = book.Snapshot(0)
+	require.Len(t, snapshot.Asks, 1)
+	assert.True(t, snapshot.Asks[0].Qty.Equal(decimal.NewFromInt(1)))
+	assert.Equal(t, 1, snapshot.Asks[0].Orders)
+}
+
+func TestSnapshotDepth(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+	for _, price := range []int64{99, 101, 98, 100} {
+		book.AddOrder(newBookOrder(models.OrderSideBuy, priceOf(price), 1, now))
+	}
+	book.AddOrder(newBookOrder(models.OrderSideBuy, priceOf(101), 2, now))
+
+	// Bids come best first, aggregated per price
+	snapshot := book.Snapshot(2)
+	require.Len(t, snapshot.Bids, 2)
+	assert.True(t, snapshot.Bids[0].Price.Equal(decimal.NewFromInt(101)))
+	assert.True(t, snapshot.Bids[0].Qty.Equal(decimal.NewFromInt(3)))
+	assert.Equal(t, 2, snapshot.Bids[0].Orders)
+	assert.True(t, snapshot.Bids[1].Price.Equal(decimal.NewFromInt(100)))
+	assert.Len(t, book.Snapshot(0).Bids, 4)
+}
+
+func TestBookSequence(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+	assert.Equal(t, uint64(0), book.Snapshot(0).Sequence)
+
+	ask := newBookOrder(models.OrderSideSell, priceOf(100), 5, now)
+	book.AddOrder(ask)
+	assert.Equal(t, uint64(1), book.Sequence())
+
+	// A match changes the book once however many makers it fills; a miss does not
+	book.MatchOrder(newBookOrder(models.OrderSideBuy, priceOf(100), 1, now))
+	assert.Equal(t, uint64(2), book.Sequence())
+	book.MatchOrder(newBookOrder(models.OrderSideBuy, priceOf(99), 1, now))
+	assert.Equal(t, uint64(2), book.Sequence())
+
+	assert.True(t, book.ReduceOrder(ask.ID, decimal.NewFromInt(3)))
+	assert.True(t, book.Snapshot(0).Asks[0].Qty.Equal(decimal.NewFromInt(2)))
+	assert.Equal(t, uint64(3), book.Sequence())
+
+	// Removing an order that is not resting changes nothing
+	_, removed := book.RemoveOrder(uuid.New())
+	assert.False(t, removed)
+	assert.Equal(t, uint64(3), book.Sequence())
+
+	// A rebuilt book keeps counting
+	book.Reset([]*limitbook.Order{newBookOrder(models.OrderSideBuy, priceOf(98), 1, now)})
+	snapshot := book.Snapshot(0)
+	assert.Equal(t, uint64(4), snapshot.Sequence)
+	assert.Empty(t, snapshot.Asks)
+	require.Len(t, snapshot.Bids, 1)
+}
+
+func TestBookUpdates(t *testing.T) {
+	book := limitbook.NewOrderBook(models.SymbolBTCUSD)
+	now := time.Now()
+	book.AddOrder(newBookOrder(models.OrderSideSell, priceOf(101), 2, now))
+
+	updates, snapshot := book.Subscribe()
+	assert.Equal(t, uint64(1), snapshot.Sequence)
+	require.Len(t, snapshot.Asks, 1)
+
+	// Each change sends the new depth of the levels it touched, in sequence
+	ask := newBookOrder(models.OrderSideSell, priceOf(100), 3, now)
+	book.AddOrder(ask)
+	update := <-updates
+	assert.Equal(t, uint64(2), update.Sequence)
+	assert.Empty(t, update.Bids)
+	require.Len(t, update.Asks, 1)
+	assert.True(t, update.Asks[0].Price.Equal(decimal.NewFromInt(100)))
+	assert.True(t, update.Asks[0].Qty.Equal(decimal.NewFromInt(3)))
+
+	// A sweep reports every level it took from, best first, emptied ones at zero
+	book.MatchOrder(newBookOrder(models.OrderSideBuy, priceOf(101), 4, now))
+	update = <-updates
+	assert.Equal(t, uint64(3), update.Sequence)
+	require.Len(t, update.Asks, 2)
+	assert.True(t, update.Asks[0].Price.Equal(decimal.NewFromInt(100)))
+	assert.True(t, update.Asks[0].Qty.IsZero())
+	assert.Equal(t, 0, update.Asks[0].Orders)
+	assert.True(t, update.Asks[1].Qty.Equal(decimal.NewFromInt(1)))
+
+	// A subscriber that falls behind misses updates and sees a gap
+	for i := 0; i < 102; i++ {
+		book.AddOrder(newBookOrder(models.OrderSideBuy, priceOf(90), 1, now))
+	}
+	for sequence := uint64(4); sequence < 104; sequence++ {
+		assert.Equal(t, sequence, (<-updates).Sequence)
+	}
+	book.AddOrder(newBookOrder(models.OrderSideBuy, priceOf(90), 1, now))
+	update = <-updates
+	assert.Equal(t, uint64(106), update.Sequence)
+	require.Len(t, update.Bids, 1)
+	assert.Equal(t, 103, update.Bids[0].Orders)
+
+	book.Unsubscribe(updates)
+	_, open := <-updates
+	assert.False(t, open)
+}
@@ -0,0 +1,143 @@
+package unit
+
+import (
+	"testing"
+
+	"microcoin/internal/models"
+	"microcoin/internal/portfolio"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fill(symbol models.Symbol, side models.OrderSide, price, qty float64) models.Fill {
+	return models.Fill{
+		Symbol: symbol,
+		Side:   side,
+		Price:  decimal.NewFromFloat(price),
+		Qty:    decimal.NewFromFloat(qty),
+		Fee:    decimal.Zero,
+	}
+}
+
+func TestBuildPositionsAverageCost(t *testing.T) {
+	fills := []models.Fill{
+		fill(models.SymbolBTCUSD, models.OrderSideBuy, 50000, 1),
+		fill(models.SymbolBTCUSD, models.OrderSideBuy, 60000, 1),
+		fill(models.SymbolBTCUSD, models.OrderSideSell, 65000, 0.5),
+	}
+	marks := map[models.Symbol]decimal.Decimal{
+		models.SymbolBTCUSD: decimal.NewFromFloat(70000),
+	}
+
+	positions, pnl := portfolio.BuildPositions(fills, marks)
+	require.Len(t, positions, 1)
+
+	position := positions[0]
+	assert.True(t, position.Qty.Equal(decimal.NewFromFloat(1.5)))
+	assert.True(t, position.AvgPrice.Equal(decimal.NewFromFloat(55000)))
+	assert.True(t, position.MarkPrice.Equal(decimal.NewFromFloat(70000)))
+
+	// Selling 0.5 at 65000 against a 55000 basis realizes 5000
+	assert.True(t, position.RealizedPnL.Equal(decimal.NewFromFloat(5000)))
+	// 1.5 marked from 55000 to 70000
+	assert.True(t, position.UnrealizedPnL.Equal(decimal.NewFromFloat(22500)))
+
+	assert.True(t, pnl.Realized.Equal(decimal.NewFromFloat(5000)))
+	assert.True(t, pnl.Unrealized.Equal(decimal.NewFromFloat(22500)))
+	assert.True(t, pnl.Total.Equal(decimal.NewFromFloat(27500)))
+}
+
+func TestBuildPositionsClosedAndFees(t *testing.T) {
+	buy := fill(models.SymbolETHUSD, models.OrderSideBuy, 3000, 2)
+	sell := fill(models.SymbolETHUSD, models.OrderSideSell, 2900, 2)
+	sell.Fee = decimal.NewFromFloat(5)
+
+	positions, pnl := portfolio.BuildPositions([]models.Fill{buy, sell}, nil)
+	require.Len(t, positions, 1)
+
+	position := positions[0]
+	assert.True(t, position.Qty.IsZero())
+	assert.True(t, position.AvgPrice.IsZero())
+	assert.True(t, position.UnrealizedPnL.IsZero())
+	assert.True(t, position.RealizedPnL.Equal(decimal.NewFromFloat(-205)))
+	assert.True(t, pnl.Total.Equal(decimal.NewFromFloat(-205)))
+}
+
+func TestBuildPositionsBaseCurrencyFee(t *testing.T) {
+	// Buyers pay their fee out of the coins they receive
+	buy := fill(models.SymbolBTCUSD, models.OrderSideBuy, 50000, 1)
+	buy.Fee = decimal.NewFromFloat(0.002)
+	buy.FeeCurrency = models.CurrencyBTC
+	sell := fill(models.SymbolBTCUSD, models.OrderSideSell, 55000, 0.998)
+	sell.Fee = decimal.NewFromFloat(109.78)
+	sell.FeeCurrency = models.CurrencyUSD
+
+	positions, _ := portfolio.BuildPositions([]models.Fill{buy}, nil)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].Qty.Equal(decimal.NewFromFloat(0.998)))
+	assert.True(t, positions[0].AvgPrice.Equal(decimal.NewFromFloat(50000)))
+	// The fee is valued at the fill price
+	assert.True(t, positions[0].RealizedPnL.Equal(decimal.NewFromFloat(-100)))
+
+	positions, pnl := portfolio.BuildPositions([]models.Fill{buy, sell}, nil)
+	require.Len(t, positions, 1)
+	assert.True(t, positions[0].Qty.IsZero())
+	// 0.998 * 5000 gained, less 100 and 109.78 in fees
+	assert.True(t, pnl.Realized.Equal(decimal.NewFromFloat(4780.22)), "realized %s", pnl.Realized)
+}
+
+func TestBuildPositionsFlip(t *testing.T) {
+	fills := []models.Fill{
+		fill(models.SymbolBTCUSD, models.OrderSideBuy, 50000, 1),
+		fill(models.SymbolBTCUSD, models.OrderSideSell, 52000, 3),
+		fill(models.SymbolETHUSD, models.OrderSideBuy, 3000, 1),
+	}
+
+	// Without marks positions are held at cost
+	positions, pnl := portfolio.BuildPositions(fills, map[models.Symbol]decimal.Decimal{})
+	require.Len(t, positions, 2)
+	assert.Equal(t, models.SymbolBTCUSD, positions[0].Symbol)
+	assert.Equal(t, models.SymbolETHUSD, positions[1].Symbol)
+
+	// The sell closes the long for 2000 and opens a 2 lot short at 52000
+	assert.True(t, positions[0].Qty.Equal(decimal.NewFromFloat(-2)))
+	assert.True(t, positions[0].AvgPrice.Equal(decimal.NewFromFloat(52000)))
+	assert.True(t, positions[0].RealizedPnL.Equal(decimal.NewFromFloat(2000)))
+	assert.True(t, pnl.Unrealized.IsZero())
+
+	// A lower mark is a gain on the short
+	positions, _ = portfolio.BuildPositions(fills, map[models.Symbol]decimal.Decimal{
+		models.SymbolBTCUSD: decimal.NewFromFloat(51000),
+	})
+	assert.True(t, positions[0].UnrealizedPnL.Equal(decimal.NewFromFloat(2000)))
+}
+
+func TestBuildPositionsCrossPair(t *testing.T) {
+	fills := []models.Fill{
+		fill("ETH-BTC", models.OrderSideBuy, 0.05, 2),
+		fill("ETH-BTC", models.OrderSideSell, 0.06, 1),
+	}
+	marks := map[models.Symbol]decimal.Decimal{
+		"ETH-BTC":           decimal.NewFromFloat(0.07),
+		models.SymbolBTCUSD: decimal.NewFromFloat(50000),
+	}
+
+	positions, pnl := portfolio.BuildPositions(fills, marks)
+	require.Len(t, positions, 1)
+
+	// The position reports PnL in BTC
+	position := positions[0]
+	assert.Equal(t, models.Currency("BTC"), position.QuoteCurrency)
+	assert.True(t, position.RealizedPnL.Equal(decimal.NewFromFloat(0.01)))
+	assert.True(t, position.UnrealizedPnL.Equal(decimal.NewFromFloat(0.02)))
+
+	// The totals convert it to USD at the BTC-USD mark
+	assert.True(t, pnl.Realized.Equal(decimal.NewFromFloat(500)))
+	assert.True(t, pnl.Unrealized.Equal(decimal.NewFromFloat(1000)))
+
+	// Without a BTC quote the position cannot be valued in USD
+	_, pnl = portfolio.BuildPositions(fills, map[models.Symbol]decimal.Decimal{})
+	assert.True(t, pnl.Total.IsZero())
+}
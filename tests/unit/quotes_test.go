@@ -0,0 +1,48 @@
+package unit
+
+import (
+	"testing"
+
+	"microcoin/internal/models"
+	"microcoin/internal/quotes"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSDRates(t *testing.T) {
+	mids := map[models.Symbol]decimal.Decimal{
+		"BTC-USD": decimal.NewFromFloat(50000),
+		"ETH-BTC": decimal.NewFromFloat(0.06),
+		"USD-JPY": decimal.NewFromFloat(150),
+		"SOL-XRP": decimal.NewFromFloat(10),
+	}
+
+	rates := quotes.USDRates(mids)
+	assert.True(t, rates[models.CurrencyUSD].Equal(decimal.NewFromInt(1)))
+	assert.True(t, rates["BTC"].Equal(decimal.NewFromFloat(50000)))
+
+	// ETH chains through ETH-BTC and BTC-USD
+	require.Contains(t, rates, models.Currency("ETH"))
+	assert.True(t, rates["ETH"].Equal(decimal.NewFromFloat(3000)))
+
+	// USD-JPY is inverted
+	require.Contains(t, rates, models.Currency("JPY"))
+	assert.True(t, rates["JPY"].Mul(decimal.NewFromFloat(150)).Round(10).Equal(decimal.NewFromInt(1)))
+
+	// Nothing links SOL or XRP to USD
+	assert.NotContains(t, rates, models.Currency("SOL"))
+	assert.NotContains(t, rates, models.Currency("XRP"))
+}
+
+func TestUSDRatesPrefersDirectQuote(t *testing.T) {
+	mids := map[models.Symbol]decimal.Decimal{
+		"BTC-USD": decimal.NewFromFloat(50000),
+		"ETH-BTC": decimal.NewFromFloat(0.06),
+		"ETH-USD": decimal.NewFromFloat(3100),
+	}
+
+	rates := quotes.USDRates(mids)
+	assert.True(t, rates["ETH"].Equal(decimal.NewFromFloat(3100)))
+}